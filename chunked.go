@@ -0,0 +1,58 @@
+package influx
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"github.com/influxdata/influxdb1-client/models"
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+// QueryChunked executes the query with the server returning the result in chunks of chunkSize rows
+// (the server default 10000 if <= 0), and calls fn with the series of each chunk as it arrives,
+// e.g. to stream or export a large result without holding it in memory.
+// The result cache and the tags return options are not applied.
+func (c *Cli) QueryChunked(q string, chunkSize int, fn func(series []models.Row) error, options ...QueryOptionFn) (err error) {
+	option := newQueryOption(options)
+	cq := client.Query{
+		Command:    q,
+		Database:   c.DB,
+		Chunked:    true,
+		ChunkSize:  chunkSize,
+		Parameters: option.Params,
+		Precision:  option.Epoch,
+	}
+
+	points := 0
+	start := time.Now()
+	defer func() {
+		c.observe(Event{Op: OpQuery, Query: cq.Command, DB: cq.Database, Points: points, Err: err}, start)
+	}()
+
+	rsp, err := c.QueryAsChunk(cq)
+	if err != nil {
+		return wrapServerError(err)
+	}
+	defer rsp.Close()
+
+	for {
+		r, err := rsp.NextResponse()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return wrapServerError(err)
+		}
+		if err := r.Error(); err != nil {
+			return wrapServerError(err)
+		}
+
+		for _, result := range r.Results {
+			points += countRows(result.Series)
+			if err := fn(result.Series); err != nil {
+				return err
+			}
+		}
+	}
+}
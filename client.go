@@ -1,11 +1,14 @@
 package influx
 
 import (
-	"log"
+	"crypto/tls"
+	"net/http"
+	"net/url"
 	"regexp"
 	"strings"
 	"time"
 
+	"github.com/influxdata/influxdb1-client/models"
 	client "github.com/influxdata/influxdb1-client/v2"
 )
 
@@ -22,9 +25,21 @@ func CleanQuery(query string) string {
 // Cli is the client for influx encoding/decoding.
 type Cli struct {
 	client.Client
-	Precision string
-	DB        string
-	Addr      string
+	Precision       string
+	DB              string
+	RetentionPolicy string
+	Addr            string
+	Validate        ValidateOption
+
+	tagKeysCache   Cache
+	tagValuesCache *LoadingCache[tagValuesKey, map[string][]string]
+	resultCache    *LoadingCache[ResultKey, []models.Row]
+
+	// addrs are the addresses of the servers, for the health checks.
+	addrs  []string
+	http   *httpDoer
+	hooks  []Hook
+	logger Logger
 }
 
 // Point is a point for influx measurement.
@@ -33,6 +48,13 @@ type Point struct {
 	Time        time.Time
 	Tags        map[string]string
 	Fields      map[string]interface{}
+	// DB is the database to write the point to, empty for the one of the Cli.
+	DB string
+	// RetentionPolicy is the retention policy to write the point to, empty for the default one.
+	RetentionPolicy string
+
+	// structFields maps the tag and field keys to the struct field names when encoded from a struct.
+	structFields map[string]string
 }
 
 type Config struct {
@@ -40,7 +62,76 @@ type Config struct {
 	Password  string
 	Precision string
 	Addr      string
-	Client    client.Client
+	// DB and RetentionPolicy are the default ones of the Cli.
+	DB              string
+	RetentionPolicy string
+	// Timeout is the timeout of the HTTP requests, 0 for no timeout.
+	Timeout  time.Duration
+	Client   client.Client
+	Validate ValidateOption
+	// TagKeysCache caches the tag keys for WithTagsReturn, defaults to a 24h TTL cache owned by the Cli.
+	TagKeysCache Cache
+	// ResultCache caches the query results, nil for no caching.
+	ResultCache *LoadingCache[ResultKey, []models.Row]
+
+	// Addrs are the addresses of multiple replicas, which override Addr.
+	Addrs               []string
+	Balance             Balance
+	WriteAll            bool
+	HealthCheckInterval time.Duration
+
+	// Shards are the addresses of the shards, which override Addrs and Addr.
+	Shards []string
+	// ShardTags are the tag keys to hash with the measurement for sharding, all tags when empty.
+	ShardTags []string
+
+	// TLSConfig is the TLS config of the HTTP transport, built from the CAFile, CertFile and KeyFile if nil.
+	TLSConfig          *tls.Config
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	InsecureSkipVerify bool
+	Proxy              func(*http.Request) (*url.URL, error)
+	UserAgent          string
+	// Headers are added to every request.
+	Headers http.Header
+	// Token is the API token of InfluxDB 2.x.
+	Token string
+	// Org is the organization name of InfluxDB 2.x for the writes.
+	Org string
+	// Hooks observe the calls to the server.
+	Hooks []Hook
+	// Logger logs the failures which are not returned to the callers, defaults to the standard log package.
+	Logger Logger
+}
+
+func (c *Config) httpConfig(addr string) client.HTTPConfig {
+	return client.HTTPConfig{
+		Addr:               addr,
+		Username:           c.User,
+		Password:           c.Password,
+		UserAgent:          c.UserAgent,
+		Timeout:            c.Timeout,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+		TLSConfig:          c.TLSConfig,
+		Proxy:              c.Proxy,
+	}
+}
+
+// newHTTPClient creates the influxdb client of the address, which writes by the v2 API
+// for InfluxDB 2.x when the token is set.
+func (c *Config) newHTTPClient(addr string) (client.Client, error) {
+	hc, err := client.NewHTTPClient(c.httpConfig(addr))
+	if err != nil {
+		return nil, err
+	}
+	if err := c.wrapTransport(hc); err != nil {
+		return nil, err
+	}
+	if c.Token == "" {
+		return hc, nil
+	}
+	return &v2Client{Client: hc, addr: addr, org: c.Org, http: c.httpDoer()}, nil
 }
 
 // WithAddr set Addr which typically like: http://localhost:8086.
@@ -54,11 +145,29 @@ func WithUser(user, password string) ConfigFn {
 }
 
 // WithClient create a client using a direct client.Client.
+// Ping and Health still request the address of WithAddr, which should be set to the server of the client.
 func WithClient(client client.Client) ConfigFn { return func(c *Config) { c.Client = client } }
 
 // WithPrecision set precision which can be ‘h’, ‘m’, ‘s’, ‘ms’, ‘u’, or ‘ns’ and is used during write operations.
 func WithPrecision(precision string) ConfigFn { return func(c *Config) { c.Precision = precision } }
 
+// WithDatabase set the default database of the Cli.
+func WithDatabase(db string) ConfigFn { return func(c *Config) { c.DB = db } }
+
+// WithRetentionPolicy set the default retention policy of the Cli.
+func WithRetentionPolicy(rp string) ConfigFn { return func(c *Config) { c.RetentionPolicy = rp } }
+
+// WithTimeout set the timeout of the HTTP requests.
+func WithTimeout(timeout time.Duration) ConfigFn { return func(c *Config) { c.Timeout = timeout } }
+
+// WithTagKeysCache set the TTL and the max entries of the tag keys cache owned by the Cli.
+func WithTagKeysCache(ttl time.Duration, maxEntries int) ConfigFn {
+	return func(c *Config) { c.TagKeysCache = NewTagKeysCache(ttl, maxEntries) }
+}
+
+// WithCache set the tag keys cache, e.g. to share it among Clis.
+func WithCache(cache Cache) ConfigFn { return func(c *Config) { c.TagKeysCache = cache } }
+
 type ConfigFn func(*Config)
 
 // New returns a new influx *Cli.
@@ -68,30 +177,165 @@ func New(fns ...ConfigFn) (*Cli, error) {
 		fn(c)
 	}
 
+	return newCli(c)
+}
+
+func newCli(c *Config) (*Cli, error) {
+	if err := c.loadTLS(); err != nil {
+		return nil, err
+	}
+	if c.Token != "" && c.User == "" {
+		WithHeader("Authorization", "Token "+c.Token)(c)
+	}
+
+	addrs := []string{c.Addr}
+	if len(c.Shards) > 0 {
+		addrs = c.Shards
+	} else if len(c.Addrs) > 0 {
+		addrs = c.Addrs
+	}
+
+	if c.Client == nil && len(c.Shards) > 0 {
+		sc, err := newShardedClient(c)
+		if err != nil {
+			return nil, err
+		}
+		c.Client, c.Addr = sc, strings.Join(c.Shards, ",")
+	}
+
+	if c.Client == nil && len(c.Addrs) > 0 {
+		mc, err := newMultiClient(c)
+		if err != nil {
+			return nil, err
+		}
+		c.Client, c.Addr = mc, strings.Join(c.Addrs, ",")
+	}
+
 	if c.Client == nil {
 		var err error
-		if c.Client, err = client.NewHTTPClient(client.HTTPConfig{
-			Addr:     c.Addr,
-			Username: c.User, Password: c.Password,
-		}); err != nil {
+		if c.Client, err = c.newHTTPClient(c.Addr); err != nil {
 			return nil, err
 		}
 	}
 
-	return &Cli{Precision: c.Precision, Client: c.Client, Addr: c.Addr}, nil
+	if c.Logger == nil {
+		c.Logger = stdLogger{}
+	}
+
+	if c.TagKeysCache == nil {
+		c.TagKeysCache = NewTagKeysCache(24*time.Hour, defaultMaxEntries)
+	}
+
+	return &Cli{
+		Precision: c.Precision, Client: c.Client, Addr: c.Addr, Validate: c.Validate,
+		DB: c.DB, RetentionPolicy: c.RetentionPolicy, addrs: addrs, http: c.httpDoer(), hooks: c.Hooks, logger: c.Logger,
+		tagKeysCache: c.TagKeysCache, tagValuesCache: newTagValuesCache(), resultCache: c.ResultCache,
+	}, nil
 }
 
 // UseDB sets the DB to use for Query, WritePoint, and WritePointTagsFields.
+// It modifies the Cli in place, use WithDB instead when the Cli is shared among goroutines.
 func (c *Cli) UseDB(db string) *Cli {
 	c.DB = db
 	return c
 }
 
+// WithDB returns a copy of the Cli which uses the DB, the Cli itself is not modified.
+func (c *Cli) WithDB(db string) *Cli {
+	cc := *c
+	cc.DB = db
+	return &cc
+}
+
+// WithRP returns a copy of the Cli which writes to the retention policy, the Cli itself is not modified.
+func (c *Cli) WithRP(rp string) *Cli {
+	cc := *c
+	cc.RetentionPolicy = rp
+	return &cc
+}
+
+// WriteOption defines the options for writing, which override the ones of the Cli.
+type WriteOption struct {
+	DB              string
+	RetentionPolicy string
+	// Consistency is the write consistency, which can be any, one, quorum or all.
+	Consistency string
+	Precision   string
+}
+
+// WriteOptionFn defines the write option func.
+type WriteOptionFn func(*WriteOption)
+
+// WithWriteDB set the database to write to.
+func WithWriteDB(db string) WriteOptionFn { return func(o *WriteOption) { o.DB = db } }
+
+// WithWriteRP set the retention policy to write to.
+func WithWriteRP(rp string) WriteOptionFn { return func(o *WriteOption) { o.RetentionPolicy = rp } }
+
+// WithWriteConsistency set the write consistency, which can be any, one, quorum or all.
+func WithWriteConsistency(consistency string) WriteOptionFn {
+	return func(o *WriteOption) { o.Consistency = consistency }
+}
+
+// WithWritePrecision set the write precision which can be ‘h’, ‘m’, ‘s’, ‘ms’, ‘u’, or ‘ns’.
+func WithWritePrecision(precision string) WriteOptionFn {
+	return func(o *WriteOption) { o.Precision = precision }
+}
+
+// newWriteOption resolves the write option for the point, from the options, the point and the Cli in order.
+func (c *Cli) newWriteOption(p Point, options []WriteOptionFn) *WriteOption {
+	option := &WriteOption{}
+	for _, f := range options {
+		f(option)
+	}
+
+	if option.DB == "" {
+		option.DB = p.DB
+	}
+	if option.DB == "" {
+		option.DB = c.DB
+	}
+	if option.RetentionPolicy == "" {
+		option.RetentionPolicy = p.RetentionPolicy
+	}
+	if option.RetentionPolicy == "" {
+		option.RetentionPolicy = c.RetentionPolicy
+	}
+	if option.Precision == "" {
+		option.Precision = c.Precision
+	}
+
+	return option
+}
+
 // QueryOption defines the options for querying.
 type QueryOption struct {
 	ReturnTags           *map[string][]string
 	ReturnTagValuesLimit int
-	tagKeys              map[string]bool
+	ReturnTagHistograms  *map[string]TagHistogram
+	ReturnTagValuesTopN  int
+	// ServerTagValues tells the ReturnTags values should be queried from the server by SHOW TAG VALUES,
+	// rather than collected from the returned rows.
+	ServerTagValues bool
+	Strict          bool
+	// TagErrors is the policy on the failures to look up the tags from the server.
+	TagErrors TagErrorPolicy
+	// Params are the parameters of the query.
+	Params map[string]interface{}
+	// CacheTTL overrides the default TTL of the result cache for the query.
+	CacheTTL time.Duration
+	// NoCache skips the result cache for the query.
+	NoCache bool
+	// CacheTimeBucket is the bucket to truncate now() to for caching.
+	CacheTimeBucket time.Duration
+	// Epoch is the precision of the returned epoch timestamps, h, m, s, ms, u or ns, RFC3339 strings if empty.
+	Epoch string
+
+	tagKeys         map[string]bool
+	serverTagValues map[string][]string
+	tagErr          *TagLookupError
+	// measurement is the metadata of the decoding destination.
+	measurement MeasurementMeta
 }
 
 // QueryOptionFn defines the option func.
@@ -105,50 +349,107 @@ func WithTagsReturn(tags *map[string][]string, valuesLimit int) QueryOptionFn {
 	}
 }
 
+// WithTagHistogramsReturn specifying the histograms of the tag values should be returned,
+// with the topN most frequent values of each tag, 0 for all.
+func WithTagHistogramsReturn(histograms *map[string]TagHistogram, topN int) QueryOptionFn {
+	return func(q *QueryOption) {
+		q.ReturnTagHistograms = histograms
+		q.ReturnTagValuesTopN = topN
+	}
+}
+
+// WithServerTagValues makes the tag values of WithTagsReturn queried from the server by
+// SHOW TAG VALUES FROM <measurement> WITH KEY IN (...), scoped by the time condition of the query,
+// so that they are complete independently of the rows returned (e.g. limited by LIMIT 100).
+func WithServerTagValues() QueryOptionFn { return func(q *QueryOption) { q.ServerTagValues = true } }
+
+// tagErrOrNil returns the tag lookup error under the TagErrorReturn policy, avoiding the typed nil.
+func (q *QueryOption) tagErrOrNil() error {
+	if q.tagErr == nil {
+		return nil
+	}
+	return q.tagErr
+}
+
+// returnsTags tells whether the tag values should be returned.
+func (q *QueryOption) returnsTags() bool { return q.ReturnTags != nil || q.ReturnTagHistograms != nil }
+
+// WithStrictDecode makes decoding report result columns which have no matching struct field,
+// and struct fields tagged with `influx:",required"` which are absent from the result,
+// as a *StrictDecodeError. The result is still decoded as far as possible.
+func WithStrictDecode() QueryOptionFn { return func(q *QueryOption) { q.Strict = true } }
+
+// WithEpoch makes the server return the timestamps as the epoch numbers in the precision, h, m, s, ms, u or ns.
+func WithEpoch(epoch string) QueryOptionFn { return func(q *QueryOption) { q.Epoch = epoch } }
+
 // DecodeQuery executes an InfluxDb query, and unpacks the result into the result data structure.
 //
-// result must be an array of structs that contains the fields returned by the query. The struct
+// result is typically an array of structs that contains the fields returned by the query,
+// see DecodeOption for the other supported destinations. The struct
 // type must always contain a Time field. The struct type must also include influx field tags
 // which map the struct field name to the InfluxDb field/tag names. This tag is currently
 // required as typically Go struct field names start with a capital letter, and InfluxDb field/tag
 // names typically start with a lower case letter. The struct field tag can be set to '-' which
 // indicates this field should be ignored.
-
 func (c *Cli) DecodeQuery(q string, result interface{}, options ...QueryOptionFn) error {
+	option := newQueryOption(options)
+	option.measurement = MeasurementOf(result)
+	series, err := c.query(q, option)
+	if err != nil {
+		return err
+	}
+
+	if err := DecodeOption(series, result, option); err != nil {
+		return err
+	}
+	return option.tagErrOrNil()
+}
+
+func newQueryOption(options []QueryOptionFn) *QueryOption {
 	option := &QueryOption{}
 	for _, f := range options {
 		f(option)
 	}
+	return option
+}
 
+// query executes the query and returns the series of the first result.
+func (c *Cli) query(q string, option *QueryOption) ([]models.Row, error) {
 	// sample results check website
 	// https://docs.influxdata.com/influxdb/v1.7/guides/querying_data/
 	cq := client.Query{
-		Command:   q,
-		Database:  c.DB,
-		Chunked:   false,
-		ChunkSize: 100,
+		Command:         q,
+		Database:        c.DB,
+		RetentionPolicy: option.measurement.RetentionPolicy,
+		Chunked:         false,
+		ChunkSize:       100,
+		Parameters:      option.Params,
+		Precision:       option.Epoch,
 	}
-	response, err := c.Query(cq)
-	if err != nil {
-		return err
+	// the db of the decoding destination takes precedence, like the writes of it
+	if option.measurement.DB != "" {
+		cq.Database = option.measurement.DB
 	}
-	if response.Error() != nil {
-		return response.Error()
+	start := time.Now()
+	series, err := c.execQuery(&cq, option)
+	c.observe(Event{Op: OpQuery, Query: cq.Command, DB: cq.Database, Points: countRows(series), Err: err}, start)
+	if err != nil || len(series) == 0 {
+		return series, err
 	}
 
-	if len(response.Results) == 0 {
-		return nil
+	if option.returnsTags() {
+		if option.tagKeys, err = c.queryTagKeys(&cq, series, option.measurement); err != nil {
+			c.tagLookupFailed(option, OpTagKeys, err)
+		}
 	}
 
-	series := response.Results[0].Series
-
-	if option.ReturnTags != nil {
-		if option.tagKeys, err = c.queryTagKeys(&cq, series); err != nil {
-			log.Printf("query tag keys failed: %v", err)
+	if option.ReturnTags != nil && option.ServerTagValues && len(option.tagKeys) > 0 {
+		if option.serverTagValues, err = c.queryTagValues(&cq, series, option.measurement, option.tagKeys); err != nil {
+			c.tagLookupFailed(option, OpTagValues, err)
 		}
 	}
 
-	return DecodeOption(series, result, option)
+	return series, nil
 }
 
 // WritePoint is used to write arbitrary data into InfluxDb.
@@ -158,20 +459,27 @@ func (c *Cli) DecodeQuery(q string, result interface{}, options ...QueryOptionFn
 // struct field should be an InfluxDb tag (vs field). A tag of '-' indicates
 // the struct field should be ignored. A struct field of Time is required and
 // is used for the time of the sample.
-func (c *Cli) WritePoint(data interface{}) error {
+func (c *Cli) WritePoint(data interface{}, options ...WriteOptionFn) error {
 	point, err := Encode(data)
 	if err != nil {
 		return err
 	}
 
-	return c.WritePointRaw(point)
+	return c.WritePointRaw(point, options...)
 }
 
 // WritePointRaw is used to write a point specifying tags and fields.
-func (c *Cli) WritePointRaw(p Point) (err error) {
+func (c *Cli) WritePointRaw(p Point, options ...WriteOptionFn) (err error) {
+	if p, err = p.Validate(c.Validate); err != nil {
+		return err
+	}
+
+	option := c.newWriteOption(p, options)
 	bp, err := client.NewBatchPoints(client.BatchPointsConfig{
-		Database:  c.DB,
-		Precision: c.Precision,
+		Database:         option.DB,
+		RetentionPolicy:  option.RetentionPolicy,
+		WriteConsistency: option.Consistency,
+		Precision:        option.Precision,
 	})
 	if err != nil {
 		return err
@@ -184,5 +492,72 @@ func (c *Cli) WritePointRaw(p Point) (err error) {
 
 	bp.AddPoint(pt)
 
-	return c.Write(bp)
+	if err := c.write(bp); err != nil {
+		return err
+	}
+
+	c.invalidateNewTagKeys(option.DB, p)
+	return nil
+}
+
+// WritePointsRaw writes the points in batches, one per the database, retention policy and precision.
+// The batches written before a failed one are not rolled back.
+func (c *Cli) WritePointsRaw(points []Point, options ...WriteOptionFn) error {
+	type batch struct {
+		bp     client.BatchPoints
+		points []Point
+	}
+
+	var batches []*batch
+	index := make(map[WriteOption]*batch)
+	for _, p := range points {
+		p, err := p.Validate(c.Validate)
+		if err != nil {
+			return err
+		}
+
+		option := c.newWriteOption(p, options)
+		b, ok := index[*option]
+		if !ok {
+			bp, err := client.NewBatchPoints(client.BatchPointsConfig{
+				Database:         option.DB,
+				RetentionPolicy:  option.RetentionPolicy,
+				WriteConsistency: option.Consistency,
+				Precision:        option.Precision,
+			})
+			if err != nil {
+				return err
+			}
+			b = &batch{bp: bp}
+			index[*option] = b
+			batches = append(batches, b)
+		}
+
+		pt, err := client.NewPoint(p.Measurement, p.Tags, p.Fields, p.Time)
+		if err != nil {
+			return err
+		}
+		b.bp.AddPoint(pt)
+		b.points = append(b.points, p)
+	}
+
+	for _, b := range batches {
+		if err := c.write(b.bp); err != nil {
+			return err
+		}
+		for _, p := range b.points {
+			c.invalidateNewTagKeys(b.bp.Database(), p)
+		}
+	}
+	return nil
+}
+
+func (c *Cli) write(bp client.BatchPoints) error {
+	start := time.Now()
+	err := wrapServerError(c.Write(bp))
+	c.observe(Event{
+		Op: OpWrite, DB: bp.Database(), RetentionPolicy: bp.RetentionPolicy(),
+		Points: len(bp.Points()), Bytes: c.lineBytes(bp), Err: err,
+	}, start)
+	return err
 }
@@ -2,57 +2,82 @@ package influx_test
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/bingoohuang/influx"
+	"github.com/bingoohuang/influx/influxtest"
 	"github.com/go-playground/assert/v2"
+	"github.com/influxdata/influxdb1-client/models"
 	client "github.com/influxdata/influxdb1-client/v2"
 )
 
 func TestExample20(t *testing.T) {
-	cli, _ := influx.New(influx.WithAddr("http://localhost:8086"))
+	s := influxtest.NewServer("king")
+	defer s.Close()
+	_ = s.WriteLines("king", `weather,location=us-midwest temperature=82,humidity=71 1465839830100400200`)
+
+	cli, _ := influx.New(influx.WithAddr(s.URL))
 	var m map[string]string
-	// INSERT weather,location=us-midwest temperature=82,humidity=71 1465839830100400200
 	tags := make(map[string][]string)
-	cli.UseDB("king").DecodeQuery(`select * from king.autogen.weather`, &m, influx.WithTagsReturn(&tags, 2))
-	cli.UseDB("king").DecodeQuery(`select * from king.autogen.weather`, &m, influx.WithTagsReturn(&tags, 2))
+	assert.Equal(t, nil, cli.UseDB("king").DecodeQuery(`select * from king.autogen.weather`, &m, influx.WithTagsReturn(&tags, 2)))
+	assert.Equal(t, nil, cli.UseDB("king").DecodeQuery(`select * from king.autogen.weather`, &m, influx.WithTagsReturn(&tags, 2)))
 
-	fmt.Println(m)
-	fmt.Println(tags)
-	// Output:
-	//	map[InfluxMeasurement:weather humidity:71 location:us-midwest temperature:82 time:2016-06-13T17:43:50.1004002Z]
-	//	map[location:[us-midwest]]
+	assert.Equal(t, map[string]string{
+		"InfluxMeasurement": "weather", "humidity": "71", "location": "us-midwest", "temperature": "82",
+		"time": "2016-06-13T17:43:50.1004002Z",
+	}, m)
+	assert.Equal(t, map[string][]string{"location": {"us-midwest"}}, tags)
 }
 
 func TestExample21(t *testing.T) {
-	cli, _ := influx.New(influx.WithAddr("http://192.168.127.23:10014"))
+	s := influxtest.NewServer("metrics")
+	defer s.Close()
+	_ = s.WriteLines("metrics", "QPS_dsvsServer,server=s1 qps=10 1\nQPS_dsvsServer,server=s2 qps=20 2")
+
+	cli, _ := influx.New(influx.WithAddr(s.URL))
 	var m map[string]string
 	tags := make(map[string][]string)
-	cli.UseDB("metrics").DecodeQuery(`select * from metrics.autogen.QPS_dsvsServer order by time desc limit 100`, &m, influx.WithTagsReturn(&tags, 0))
+	assert.Equal(t, nil, cli.UseDB("metrics").DecodeQuery(`select * from metrics.autogen.QPS_dsvsServer order by time desc limit 100`, &m, influx.WithTagsReturn(&tags, 0)))
 
-	fmt.Println(m)
-	fmt.Println(tags)
+	assert.Equal(t, "s2", m["server"])
+	assert.Equal(t, map[string][]string{"server": {"s1", "s2"}}, tags)
 }
 
 func TestExample(t *testing.T) {
-	cli, _ := influx.New(influx.WithAddr("http://localhost:8086"))
+	s := influxtest.NewServer("telegraf")
+	defer s.Close()
+	_ = s.CreateRetentionPolicy("telegraf", "oneweek")
+	now := time.Now().Truncate(time.Second)
+	_ = s.WriteLinesRP("telegraf", "oneweek", fmt.Sprintf("cpu,cpu=cpu7,host=tencent-beta01 usage_idle=99.8,usage_user=0.1 %d\n"+
+		"cpu,cpu=cpu7,host=tencent-beta01 usage_idle=99.7,usage_user=0.2 %d", now.Add(-time.Minute).UnixNano(), now.UnixNano()))
+
+	cli, _ := influx.New(influx.WithAddr(s.URL))
 	var m map[string]string
-	cli.DecodeQuery(`select * from telegraf.oneweek.cpu where time > now() - 5m order by time desc limit 1`, &m)
+	assert.Equal(t, nil, cli.DecodeQuery(`select * from telegraf.oneweek.cpu where time > now() - 5m order by time desc limit 1`, &m))
 
-	fmt.Println(m)
-	// Output:
-	// map[InfluxMeasurement:cpu cpu:cpu7 host:tencent-beta01 ip:192.168.106.3 ips:192.168.106.3 time:2021-12-09T04:31:22Z time_active:62547.40000000037 time_guest:0 time_guest_nice:0 time_idle:6827183.36 time_iowait:216.63 time_irq:14.15 time_nice:5.92 time_softirq:1013.13 time_steal:0 time_system:28451.05 time_user:32846.52 usage_active:0.2004008064468124 usage_guest:0 usage_guest_nice:0 usage_idle:99.79959919355319 usage_iowait:0 usage_irq:0 usage_nice:0 usage_softirq:0 usage_steal:0 usage_system:0.10020040078107574 usage_user:0.10020040074462304]
+	assert.Equal(t, map[string]string{
+		"InfluxMeasurement": "cpu", "cpu": "cpu7", "host": "tencent-beta01", "usage_idle": "99.7", "usage_user": "0.2",
+		"time": now.UTC().Format(time.RFC3339),
+	}, m)
 }
 
 func TestInflux(t *testing.T) {
 	const db = "demo"
 
-	c, err := influx.New(influx.WithAddr("http://localhost:8086"))
+	s := influxtest.NewServer()
+	defer s.Close()
+
+	c, err := influx.New(influx.WithAddr(s.URL))
 	if err != nil {
-		return
+		t.Fatal(err)
 	}
 
 	// Create test database if it doesn't already exist
@@ -63,27 +88,26 @@ func TestInflux(t *testing.T) {
 	cq = client.NewQuery("CREATE DATABASE "+db, "", "")
 	res, err := c.Query(cq)
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
 	}
 
 	if res.Error() != nil {
-		panic(res.Error())
+		t.Fatal(res.Error())
 	}
-	log.Print("db initialized")
 
 	// write sample data to database
 	samples := generateSampleData()
 	c = c.UseDB(db)
 	for _, p := range samples {
 		if err := c.WritePoint(p); err != nil {
-			log.Fatal("Error writing point: ", err)
+			t.Fatal("Error writing point: ", err)
 		}
 	}
 
 	var samplesRead []envSample
 
 	if err = c.UseDB(db).DecodeQuery(`SELECT * FROM test ORDER BY time`, &samplesRead); err != nil {
-		log.Fatal("Query error: ", err)
+		t.Fatal("Query error: ", err)
 	}
 
 	s1, _ := json.Marshal(samples)
@@ -116,7 +140,7 @@ func generateSampleData() []envSample {
 	return ret
 }
 
-func ExampleClient_WritePoint() {
+func ExampleCli_WritePoint() {
 	c, _ := influx.New(influx.WithAddr("http://localhost:8086"))
 
 	type EnvSample struct {
@@ -138,7 +162,7 @@ func ExampleClient_WritePoint() {
 	_ = c.UseDB("myDb").WritePoint(s)
 }
 
-func ExampleClient_Query() {
+func ExampleCli_DecodeQuery() {
 	c, _ := influx.New(influx.WithAddr("http://localhost:8086"))
 
 	type EnvSample struct {
@@ -156,3 +180,396 @@ func ExampleClient_Query() {
 
 	// samplesRead is now populated with data from InfluxDb
 }
+
+func TestTypedErrors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/write":
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"partial write: field type conflict: input field \"value\" on measurement \"cpu\" is type float, already exists as type integer dropped=2"}`))
+		case "/query":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"results":[{"statement_id":0,"error":"database not found: nope"}]}`))
+		}
+	}))
+	defer ts.Close()
+
+	c, err := influx.New(influx.WithAddr(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.UseDB("nope").WritePointRaw(influx.Point{
+		Measurement: "cpu", Fields: map[string]interface{}{"value": 1.5}, Time: time.Now(),
+	})
+	var pe *influx.PartialWriteError
+	if !errors.As(err, &pe) || pe.Dropped != 2 {
+		t.Errorf("expected *PartialWriteError dropped 2, got %v", err)
+	}
+	var fe *influx.FieldTypeConflictError
+	if !errors.As(err, &fe) || fe.Measurement != "cpu" || fe.Field != "value" || fe.ExistingType != "integer" {
+		t.Errorf("expected *FieldTypeConflictError, got %v", err)
+	}
+
+	var m map[string]interface{}
+	if err := c.DecodeQuery(`select * from cpu`, &m); !errors.Is(err, influx.ErrDatabaseNotFound) {
+		t.Errorf("expected ErrDatabaseNotFound, got %v", err)
+	}
+}
+
+// bodyError is like the error of the client, with the raw body of the failed write.
+type bodyError struct{ body string }
+
+func (e *bodyError) Error() string { return e.body }
+
+// failingClient fails the writes by the error.
+type failingClient struct {
+	client.Client
+	err error
+}
+
+func (c *failingClient) Write(client.BatchPoints) error { return c.err }
+
+func TestTypedErrorsWrapOriginal(t *testing.T) {
+	original := &bodyError{body: `{"error":"partial write: points beyond retention policy dropped=1"}`}
+	c, err := influx.New(influx.WithClient(&failingClient{err: original}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.WritePointRaw(influx.Point{Measurement: "cpu", Fields: map[string]interface{}{"v": 1}, Time: time.Now()})
+	var pe *influx.PartialWriteError
+	if !errors.As(err, &pe) || pe.Dropped != 1 || err.Error() != "partial write: points beyond retention policy dropped=1" {
+		t.Errorf("expected *PartialWriteError with the parsed message, got %v", err)
+	}
+	var be *bodyError
+	if !errors.Is(err, original) || !errors.As(err, &be) || be != original {
+		t.Errorf("expected the original error wrapped, got %v", err)
+	}
+}
+
+func TestWriteOptions(t *testing.T) {
+	var params []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		params = append(params, q.Get("db")+"|"+q.Get("rp")+"|"+q.Get("consistency")+"|"+q.Get("precision"))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	c, err := influx.New(influx.WithAddr(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type Cpu struct {
+		_     string `influx:",measurement:cpu,rp:oneweek"`
+		Time  time.Time
+		Value float64
+	}
+
+	d1 := c.WithDB("db1")
+	d2 := c.WithDB("db2").WithRP("autogen")
+	if c.DB != "" || d1.DB != "db1" {
+		t.Error("WithDB must not modify the original Cli")
+	}
+
+	_ = d1.WritePoint(Cpu{Time: time.Now(), Value: 1})
+	_ = d2.WritePoint(Cpu{Time: time.Now(), Value: 1}, influx.WithWriteRP("onemonth"),
+		influx.WithWriteConsistency("all"), influx.WithWritePrecision("s"))
+	_ = d2.WritePointRaw(influx.Point{Measurement: "mem", Fields: map[string]interface{}{"v": 1}, Time: time.Now()},
+		influx.WithWriteDB("db3"))
+
+	expected := []string{"db1|oneweek||ns", "db2|onemonth|all|s", "db3|autogen||ns"}
+	if !reflect.DeepEqual(params, expected) {
+		t.Errorf("%v != %v", params, expected)
+	}
+
+	// the db and rp of the point are kept by the validation
+	params = nil
+	v, err := influx.New(influx.WithAddr(ts.URL), influx.WithValidation(influx.ValidateOption{Policy: influx.ValidateDrop}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := influx.Point{Measurement: "mem", DB: "db4", RetentionPolicy: "oneday",
+		Tags: map[string]string{"host": ""}, Fields: map[string]interface{}{"v": 1}, Time: time.Now()}
+	_ = v.WritePointRaw(p)
+	_ = v.WritePointsRaw([]influx.Point{p})
+	if expected := []string{"db4|oneday||ns", "db4|oneday||ns"}; !reflect.DeepEqual(params, expected) {
+		t.Errorf("%v != %v", params, expected)
+	}
+}
+
+func TestQueryMeasurementDB(t *testing.T) {
+	var params []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		params = append(params, q.Get("db")+"|"+q.Get("rp"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"results":[{}]}`))
+	}))
+	defer ts.Close()
+
+	c, err := influx.New(influx.WithAddr(ts.URL), influx.WithDatabase("db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type Cpu struct {
+		_     string `influx:",measurement:cpu,db:telegraf,rp:oneweek"`
+		Value float64
+	}
+	type Mem struct {
+		Value float64
+	}
+	var cpus []Cpu
+	var mems []Mem
+	_ = c.DecodeQuery(`SELECT * FROM cpu`, &cpus)
+	_ = c.DecodeQuery(`SELECT * FROM mem`, &mems)
+
+	if expected := []string{"telegraf|oneweek", "db|"}; !reflect.DeepEqual(params, expected) {
+		t.Errorf("%v != %v", params, expected)
+	}
+}
+
+func TestTagKeysLookup(t *testing.T) {
+	var lookups []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q, db := r.URL.Query().Get("q"), r.URL.Query().Get("db")
+		w.Header().Set("Content-Type", "application/json")
+		switch q {
+		case `show tag keys from "cpu"`:
+			lookups = append(lookups, db+":cpu")
+			_, _ = w.Write([]byte(`{"results":[{"series":[{"name":"cpu","columns":["tagKey"],"values":[["host"]]}]}]}`))
+		case `show tag keys from "mem"`:
+			lookups = append(lookups, db+":mem")
+			_, _ = w.Write([]byte(`{"results":[{"series":[{"name":"mem","columns":["tagKey"],"values":[["region"]]}]}]}`))
+		default:
+			_, _ = w.Write([]byte(`{"results":[{"series":[
+				{"name":"cpu","columns":["time","host","v"],"values":[["2021-12-09T04:31:22Z","a",1]]},
+				{"name":"mem","columns":["time","region","v"],"values":[["2021-12-09T04:31:22Z","us",2]]}
+			]}]}`))
+		}
+	}))
+	defer ts.Close()
+
+	c, err := influx.New(influx.WithAddr(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rows []map[string]interface{}
+	tags := make(map[string][]string)
+	err = c.WithDB("other").DecodeQuery(`SELECT * FROM telegraf.autogen.cpu, "telegraf"."autogen"."mem"`, &rows,
+		influx.WithTagsReturn(&tags, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(lookups, []string{"telegraf:cpu", "telegraf:mem"}) {
+		t.Errorf("wrong lookups %v", lookups)
+	}
+	if !reflect.DeepEqual(tags, map[string][]string{"host": {"a"}, "region": {"us"}}) {
+		t.Errorf("wrong tags %v", tags)
+	}
+}
+
+func TestTagHistogramsReturn(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasPrefix(r.URL.Query().Get("q"), "show tag keys") {
+			_, _ = w.Write([]byte(`{"results":[{"series":[{"name":"cpu","columns":["tagKey"],"values":[["host"],["region"]]}]}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"results":[{"series":[
+			{"name":"cpu","tags":{"region":"us"},"columns":["time","host","v"],"values":[
+				["2021-12-09T04:31:22Z","a",1],["2021-12-09T04:31:23Z","b",1],["2021-12-09T04:31:24Z","a",1]]},
+			{"name":"cpu","tags":{"region":"eu"},"columns":["time","host","v"],"values":[
+				["2021-12-09T04:31:22Z","c",1]]}
+		]}]}`))
+	}))
+	defer ts.Close()
+
+	c, err := influx.New(influx.WithAddr(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rows []map[string]interface{}
+	histograms := make(map[string]influx.TagHistogram)
+	err = c.DecodeQuery(`SELECT * FROM cpu GROUP BY region`, &rows, influx.WithTagHistogramsReturn(&histograms, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]influx.TagHistogram{
+		"host":   {Values: []influx.TagValueCount{{"a", 2}, {"b", 1}}, Truncated: 1},
+		"region": {Values: []influx.TagValueCount{{"us", 3}, {"eu", 1}}},
+	}
+	if !reflect.DeepEqual(histograms, expected) {
+		t.Errorf("%v != %v", histograms, expected)
+	}
+}
+
+func TestServerTagValues(t *testing.T) {
+	var tagValuesQuery string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		q := r.URL.Query().Get("q")
+		switch {
+		case strings.HasPrefix(q, "show tag keys"):
+			_, _ = w.Write([]byte(`{"results":[{"series":[{"name":"cpu","columns":["tagKey"],"values":[["host"],["region"]]}]}]}`))
+		case strings.HasPrefix(q, "show tag values"):
+			tagValuesQuery = q
+			_, _ = w.Write([]byte(`{"results":[{"series":[{"name":"cpu","columns":["key","value"],"values":[
+				["host","a"],["host","b"],["host","c"],["region","us"]]}]}]}`))
+		default:
+			_, _ = w.Write([]byte(`{"results":[{"series":[
+				{"name":"cpu","columns":["time","host","region","v"],"values":[["2021-12-09T04:31:22Z","a","us",1]]}
+			]}]}`))
+		}
+	}))
+	defer ts.Close()
+
+	c, err := influx.New(influx.WithAddr(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rows []map[string]interface{}
+	tags := make(map[string][]string)
+	err = c.DecodeQuery(`SELECT * FROM cpu WHERE time > now() - 1h LIMIT 1`, &rows,
+		influx.WithTagsReturn(&tags, 0), influx.WithServerTagValues())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedQuery := `show tag values from "cpu" with key in ("host","region") where time > now() - 1h`
+	if tagValuesQuery != expectedQuery {
+		t.Errorf("%s != %s", tagValuesQuery, expectedQuery)
+	}
+	if !reflect.DeepEqual(tags, map[string][]string{"host": {"a", "b", "c"}, "region": {"us"}}) {
+		t.Errorf("wrong tags %v", tags)
+	}
+}
+
+func TestTagKeysCache(t *testing.T) {
+	var lookups int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/write" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasPrefix(r.URL.Query().Get("q"), "show tag keys") {
+			atomic.AddInt32(&lookups, 1)
+			_, _ = w.Write([]byte(`{"results":[{"series":[{"name":"cpu","columns":["tagKey"],"values":[["host"]]}]}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"results":[{"series":[
+			{"name":"cpu","columns":["time","host","v"],"values":[["2021-12-09T04:31:22Z","a",1]]}]}]}`))
+	}))
+	defer ts.Close()
+
+	query := func(c *influx.Cli) {
+		var rows []map[string]interface{}
+		tags := make(map[string][]string)
+		if err := c.DecodeQuery(`SELECT * FROM cpu`, &rows, influx.WithTagsReturn(&tags, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c1, _ := influx.New(influx.WithAddr(ts.URL), influx.WithTagKeysCache(time.Hour, 10))
+	c2, _ := influx.New(influx.WithAddr(ts.URL))
+	c1 = c1.WithDB("db")
+
+	query(c1)
+	query(c1)
+	query(c2)
+	if lookups != 2 {
+		t.Errorf("expected 2 lookups for the 2 Clis, got %d", lookups)
+	}
+
+	// no new tag keys, the cache is kept
+	_ = c1.WritePointRaw(influx.Point{Measurement: "cpu", Tags: map[string]string{"host": "b"},
+		Fields: map[string]interface{}{"v": 1}, Time: time.Now()})
+	query(c1)
+	if lookups != 2 {
+		t.Errorf("expected the cache kept, got %d lookups", lookups)
+	}
+
+	// new tag key zone, the cache is invalidated
+	_ = c1.WritePointRaw(influx.Point{Measurement: "cpu", Tags: map[string]string{"host": "b", "zone": "z1"},
+		Fields: map[string]interface{}{"v": 1}, Time: time.Now()})
+	query(c1)
+	if lookups != 3 {
+		t.Errorf("expected the cache invalidated, got %d lookups", lookups)
+	}
+}
+
+func TestResultCache(t *testing.T) {
+	var queries []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query().Get("q"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"results":[{"series":[{"name":"cpu","columns":["time","v"],"values":[["2021-12-09T04:31:22Z",1]]}]}]}`))
+	}))
+	defer ts.Close()
+
+	var observed []string
+	c, err := influx.New(influx.WithAddr(ts.URL), influx.WithResultCache(time.Hour, 100),
+		influx.WithHooks(influx.HookFunc(func(e influx.Event) { observed = append(observed, e.Query) })))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var v []float64
+	for i := 0; i < 3; i++ {
+		if err := c.DecodeQuery("SELECT v FROM cpu\n  WHERE time > now() - 5m", &v, influx.WithCacheTimeBucket(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(queries) != 1 || strings.Contains(queries[0], "now()") {
+		t.Errorf("expected 1 bucketed query, got %v", queries)
+	}
+	if len(observed) != 3 || !strings.Contains(observed[0], "now()") {
+		t.Errorf("expected the original queries observed, got %v", observed)
+	}
+	if !reflect.DeepEqual(v, []float64{1}) {
+		t.Errorf("wrong result %v", v)
+	}
+
+	_ = c.DecodeQuery("SELECT v FROM cpu", &v)
+	_ = c.DecodeQuery("SELECT v FROM cpu", &v)
+	_ = c.WithDB("other").DecodeQuery("SELECT v FROM cpu", &v)
+	_ = c.DecodeQuery("SELECT v FROM cpu", &v, influx.WithoutCache())
+	_ = c.DecodeQuery("SELECT v FROM cpu WHERE host = $host", &v, influx.WithParams(map[string]interface{}{"host": "a"}))
+	_ = c.DecodeQuery("SELECT v FROM cpu WHERE host = $host", &v, influx.WithParams(map[string]interface{}{"host": "b"}))
+	// the same query on the retention policies of the measurements
+	type WeekCPU struct {
+		_ string  `influx:",measurement:cpu,rp:oneweek"`
+		V float64 `influx:"v"`
+	}
+	type MonthCPU struct {
+		_ string  `influx:",measurement:cpu,rp:onemonth"`
+		V float64 `influx:"v"`
+	}
+	var weeks []WeekCPU
+	var months []MonthCPU
+	_ = c.DecodeQuery("SELECT v FROM cpu", &weeks)
+	_ = c.DecodeQuery("SELECT v FROM cpu", &weeks)
+	_ = c.DecodeQuery("SELECT v FROM cpu", &months)
+	if len(queries) != 8 {
+		t.Errorf("expected 8 queries, got %d", len(queries))
+	}
+
+	// the rows of a cached result are not shared between the callers
+	var rows1, rows2 []models.Row
+	_ = c.DecodeQuery("SELECT v FROM cpu", &rows1)
+	rows1[0].Values[0][1] = json.Number("2")
+	rows1[0].Name = "changed"
+	_ = c.DecodeQuery("SELECT v FROM cpu", &rows2)
+	if len(queries) != 8 || rows2[0].Name != "cpu" || rows2[0].Values[0][1] != json.Number("1") {
+		t.Errorf("the cached rows were modified by the caller: %v", rows2)
+	}
+}
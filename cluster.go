@@ -0,0 +1,335 @@
+package influx
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+// Balance is the strategy to select the node for queries among the replicas.
+type Balance int
+
+const (
+	// RoundRobin selects the healthy nodes in turn.
+	RoundRobin Balance = iota
+	// LeastLatency selects the healthy node with the least average latency.
+	LeastLatency
+)
+
+// WithAddrs set the addresses of multiple replicas, e.g. http://influx1:8086, http://influx2:8086.
+// The queries (and the writes unless WithWriteAll) are balanced among the healthy nodes,
+// and fail over to the next node on connection errors. The writes only fail over when the connection
+// could not be made, since the points might have been written on the other errors like timeouts.
+func WithAddrs(addrs ...string) ConfigFn { return func(c *Config) { c.Addrs = addrs } }
+
+// WithBalance set the strategy to select the node among the replicas.
+func WithBalance(balance Balance) ConfigFn { return func(c *Config) { c.Balance = balance } }
+
+// WithWriteAll makes the writes fan out to all the replicas, for dual-write HA.
+func WithWriteAll() ConfigFn { return func(c *Config) { c.WriteAll = true } }
+
+// WithHealthCheck pings the unhealthy replicas every interval to bring them back as soon as they recover.
+// Without it, an unhealthy node is retried after the interval passively, which defaults to 10s.
+func WithHealthCheck(interval time.Duration) ConfigFn {
+	return func(c *Config) { c.HealthCheckInterval = interval }
+}
+
+// MultiWriteError is reported when the write to some of the replicas failed in the write all mode.
+type MultiWriteError struct {
+	// Errors are the errors keyed by the addresses of the failed nodes.
+	Errors map[string]error
+	// Succeeded is the number of the nodes written successfully.
+	Succeeded int
+}
+
+func (e *MultiWriteError) Error() string {
+	addrs := e.addrs()
+	parts := make([]string, len(addrs))
+	for i, addr := range addrs {
+		parts[i] = addr + ": " + e.Errors[addr].Error()
+	}
+	return fmt.Sprintf("write failed on %d node(s), succeeded on %d: %s",
+		len(addrs), e.Succeeded, strings.Join(parts, "; "))
+}
+
+// Unwrap returns the errors of the failed nodes, ordered by the addresses.
+func (e *MultiWriteError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, addr := range e.addrs() {
+		errs = append(errs, e.Errors[addr])
+	}
+	return errs
+}
+
+// Is tells whether any error of the failed nodes matches the target,
+// since errors.Is does not unwrap []error before Go 1.20.
+func (e *MultiWriteError) Is(target error) bool {
+	for _, err := range e.Unwrap() {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first error of the failed nodes that matches the target, like Is.
+func (e *MultiWriteError) As(target interface{}) bool {
+	for _, err := range e.Unwrap() {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// wrapServerErrors wraps the errors of the failed nodes into the typed errors, like the ones of a single node.
+func (e *MultiWriteError) wrapServerErrors() *MultiWriteError {
+	for addr, err := range e.Errors {
+		e.Errors[addr] = wrapServerError(err)
+	}
+	return e
+}
+
+func (e *MultiWriteError) addrs() []string {
+	addrs := make([]string, 0, len(e.Errors))
+	for addr := range e.Errors {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	return addrs
+}
+
+type node struct {
+	addr   string
+	client client.Client
+
+	mu        sync.Mutex
+	downUntil time.Time
+	// latency is the exponentially weighted moving average of the request durations.
+	latency time.Duration
+}
+
+func (n *node) healthy(now time.Time) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return !now.Before(n.downUntil)
+}
+
+func (n *node) markDown(retryAfter time.Duration) {
+	n.mu.Lock()
+	n.downUntil = time.Now().Add(retryAfter)
+	n.mu.Unlock()
+}
+
+func (n *node) markUp(d time.Duration) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.downUntil = time.Time{}
+	if n.latency == 0 {
+		n.latency = d
+	} else {
+		n.latency = (n.latency*4 + d) / 5
+	}
+}
+
+func (n *node) avgLatency() time.Duration {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.latency
+}
+
+// multiClient is a client.Client over the replicas.
+type multiClient struct {
+	nodes      []*node
+	balance    Balance
+	writeAll   bool
+	retryAfter time.Duration
+	next       uint32
+	stop       chan struct{}
+	stopOnce   sync.Once
+}
+
+func newMultiClient(c *Config) (*multiClient, error) {
+	m := &multiClient{
+		balance:    c.Balance,
+		writeAll:   c.WriteAll,
+		retryAfter: 10 * time.Second,
+		stop:       make(chan struct{}),
+	}
+	if c.HealthCheckInterval > 0 {
+		m.retryAfter = c.HealthCheckInterval
+	}
+
+	for _, addr := range c.Addrs {
+		hc, err := c.newHTTPClient(addr)
+		if err != nil {
+			return nil, err
+		}
+		m.nodes = append(m.nodes, &node{addr: addr, client: hc})
+	}
+
+	if c.HealthCheckInterval > 0 {
+		go m.healthCheck(c.HealthCheckInterval)
+	}
+
+	return m, nil
+}
+
+// candidates returns the nodes in the order to try, the healthy ones first by the balance strategy.
+func (m *multiClient) candidates() []*node {
+	now := time.Now()
+	var healthy, unhealthy []*node
+	start := int(atomic.AddUint32(&m.next, 1)-1) % len(m.nodes)
+	for i := range m.nodes {
+		n := m.nodes[(start+i)%len(m.nodes)]
+		if n.healthy(now) {
+			healthy = append(healthy, n)
+		} else {
+			unhealthy = append(unhealthy, n)
+		}
+	}
+
+	if m.balance == LeastLatency {
+		sort.SliceStable(healthy, func(i, j int) bool { return healthy[i].avgLatency() < healthy[j].avgLatency() })
+	}
+
+	// the unhealthy nodes are the last resort
+	return append(healthy, unhealthy...)
+}
+
+// do calls f on the candidate nodes in order until no connection error,
+// or the connection error which failover tells not to retry on the next node.
+func (m *multiClient) do(f func(n *node) error, failover func(error) bool) error {
+	var err error
+	for _, n := range m.candidates() {
+		start := time.Now()
+		if err = f(n); !isConnError(err) {
+			n.markUp(time.Since(start))
+			return err
+		}
+		n.markDown(m.retryAfter)
+		if !failover(err) {
+			return err
+		}
+	}
+	return err
+}
+
+func isConnError(err error) bool {
+	var ne net.Error
+	return err != nil && errors.As(err, &ne)
+}
+
+// isDialError tells the request was never sent, e.g. a refused connection, which is safe to retry
+// for the writes. A timeout might have the points written, so the retry would duplicate them.
+func isDialError(err error) bool {
+	var oe *net.OpError
+	return errors.As(err, &oe) && oe.Op == "dial" || errors.Is(err, syscall.ECONNREFUSED)
+}
+
+func (m *multiClient) Ping(timeout time.Duration) (d time.Duration, version string, err error) {
+	err = m.do(func(n *node) (e error) {
+		d, version, e = n.client.Ping(timeout)
+		return e
+	}, isConnError)
+	return d, version, err
+}
+
+func (m *multiClient) Query(q client.Query) (rsp *client.Response, err error) {
+	err = m.do(func(n *node) (e error) {
+		rsp, e = n.client.Query(q)
+		return e
+	}, isConnError)
+	return rsp, err
+}
+
+func (m *multiClient) QueryAsChunk(q client.Query) (rsp *client.ChunkedResponse, err error) {
+	err = m.do(func(n *node) (e error) {
+		rsp, e = n.client.QueryAsChunk(q)
+		return e
+	}, isConnError)
+	return rsp, err
+}
+
+func (m *multiClient) Write(bp client.BatchPoints) error {
+	if !m.writeAll {
+		return m.do(func(n *node) error { return n.client.Write(bp) }, isDialError)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(m.nodes))
+	for i, n := range m.nodes {
+		wg.Add(1)
+		go func(i int, n *node) {
+			defer wg.Done()
+			start := time.Now()
+			if errs[i] = n.client.Write(bp); isConnError(errs[i]) {
+				n.markDown(m.retryAfter)
+			} else {
+				n.markUp(time.Since(start))
+			}
+		}(i, n)
+	}
+	wg.Wait()
+
+	e := &MultiWriteError{Errors: make(map[string]error)}
+	for i, err := range errs {
+		if err != nil {
+			e.Errors[m.nodes[i].addr] = err
+		} else {
+			e.Succeeded++
+		}
+	}
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	if len(e.Errors) == 1 && len(m.nodes) == 1 {
+		return errs[0]
+	}
+	return e.wrapServerErrors()
+}
+
+func (m *multiClient) Close() error {
+	m.stopOnce.Do(func() { close(m.stop) })
+
+	var err error
+	for _, n := range m.nodes {
+		if e := n.client.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// healthCheck pings the unhealthy nodes every interval.
+func (m *multiClient) healthCheck(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			now := time.Now()
+			for _, n := range m.nodes {
+				if n.healthy(now) {
+					continue
+				}
+				start := time.Now()
+				if _, _, err := n.client.Ping(interval); err == nil {
+					n.markUp(time.Since(start))
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package influx_test
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/influx"
+)
+
+type countingServer struct {
+	*httptest.Server
+	queries, writes int32
+}
+
+func newCountingServer() *countingServer {
+	s := &countingServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/write" {
+			atomic.AddInt32(&s.writes, 1)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		atomic.AddInt32(&s.queries, 1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"results":[{"series":[{"name":"cpu","columns":["time","v"],"values":[["2021-12-09T04:31:22Z",1]]}]}]}`))
+	}))
+	return s
+}
+
+func TestMultiNodeRoundRobin(t *testing.T) {
+	s1, s2 := newCountingServer(), newCountingServer()
+	defer s1.Close()
+	defer s2.Close()
+
+	c, err := influx.New(influx.WithAddrs(s1.URL, s2.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var v float64
+	for i := 0; i < 4; i++ {
+		if err := c.DecodeQuery(`SELECT v FROM cpu`, &v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s1.queries != 2 || s2.queries != 2 {
+		t.Errorf("expected queries balanced, got %d and %d", s1.queries, s2.queries)
+	}
+}
+
+func TestMultiNodeFailover(t *testing.T) {
+	s1, s2 := newCountingServer(), newCountingServer()
+	defer s2.Close()
+	s1.Close() // s1 is down
+
+	c, err := influx.New(influx.WithAddrs(s1.URL, s2.URL), influx.WithBalance(influx.LeastLatency))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var v float64
+	for i := 0; i < 3; i++ {
+		if err := c.DecodeQuery(`SELECT v FROM cpu`, &v); err != nil || v != 1 {
+			t.Fatalf("expected failover to the healthy node, got %v %v", v, err)
+		}
+	}
+	if s2.queries != 3 {
+		t.Errorf("expected all queries on the healthy node, got %d", s2.queries)
+	}
+
+	p := influx.Point{Measurement: "cpu", Fields: map[string]interface{}{"v": 1}, Time: time.Now()}
+	if err := c.WritePointRaw(p); err != nil || s2.writes != 1 {
+		t.Errorf("expected write to the healthy node, got %d %v", s2.writes, err)
+	}
+}
+
+func TestMultiNodeTimeoutFailover(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer slow.Close()
+	s2 := newCountingServer()
+	defer s2.Close()
+
+	newCli := func() *influx.Cli {
+		c, err := influx.New(influx.WithAddrs(slow.URL, s2.URL), influx.WithTimeout(50*time.Millisecond))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	// the timed out write might have been written, so it is not retried on the next node
+	p := influx.Point{Measurement: "cpu", Fields: map[string]interface{}{"v": 1}, Time: time.Now()}
+	if err := newCli().WritePointRaw(p); !errors.Is(err, influx.ErrTimeout) || s2.writes != 0 {
+		t.Errorf("expected the write timed out without failover, got %d %v", s2.writes, err)
+	}
+
+	var v float64
+	if err := newCli().DecodeQuery(`SELECT v FROM cpu`, &v); err != nil || v != 1 || s2.queries != 1 {
+		t.Errorf("expected the timed out query failed over, got %v %v", v, err)
+	}
+}
+
+func TestMultiNodeWriteAll(t *testing.T) {
+	s1, s2, s3 := newCountingServer(), newCountingServer(), newCountingServer()
+	defer s1.Close()
+	defer s2.Close()
+	s3.Close()
+
+	c, err := influx.New(influx.WithAddrs(s1.URL, s2.URL, s3.URL), influx.WithWriteAll())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := influx.Point{Measurement: "cpu", Fields: map[string]interface{}{"v": 1}, Time: time.Now()}
+	err = c.WritePointRaw(p)
+	if s1.writes != 1 || s2.writes != 1 {
+		t.Errorf("expected writes to all nodes, got %d and %d", s1.writes, s2.writes)
+	}
+
+	var me *influx.MultiWriteError
+	if !errors.As(err, &me) || me.Succeeded != 2 || me.Errors[s3.URL] == nil {
+		t.Errorf("expected *MultiWriteError for the down node, got %v", err)
+	}
+	var oe *net.OpError
+	if !errors.Is(err, syscall.ECONNREFUSED) || !errors.As(err, &oe) || oe.Op != "dial" {
+		t.Errorf("expected the errors of the nodes matched, got %v", err)
+	}
+
+	// the errors of the nodes are typed as the ones of a single node
+	notFound := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":"database not found: \"db\""}`))
+	}))
+	defer notFound.Close()
+	c, err = influx.New(influx.WithAddrs(s1.URL, notFound.URL), influx.WithWriteAll())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.WritePointRaw(p)
+	if !errors.As(err, &me) || !errors.Is(err, influx.ErrDatabaseNotFound) || strings.Contains(err.Error(), `{"error"`) {
+		t.Errorf("expected ErrDatabaseNotFound of the node without the JSON body, got %v", err)
+	}
+}
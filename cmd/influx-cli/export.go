@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bingoohuang/influx"
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+func runExport(args []string, stdout, stderr io.Writer) int {
+	f := flag.NewFlagSet("influx-cli export", flag.ContinueOnError)
+	f.SetOutput(stderr)
+	f.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: influx-cli export --measurement m [flags], dumps the measurement in line protocol or CSV")
+		f.PrintDefaults()
+	}
+
+	e := &exporter{}
+	connectCli := connectFlags(f)
+	f.StringVar(&e.measurement.Name, "measurement", "", "the measurement to export, required")
+	f.StringVar(&e.measurement.RetentionPolicy, "rp", "", "the retention policy, the default one if empty")
+	start := f.String("start", "", "the inclusive start time in RFC3339, e.g. 2021-12-01T00:00:00Z")
+	end := f.String("end", "", "the exclusive end time in RFC3339")
+	format := f.String("format", "lp", "the output format, lp (line protocol) or csv")
+	f.IntVar(&e.chunkSize, "chunk-size", 10000, "the rows per chunk queried")
+	output := f.String("output", "", "the output file, stdout by default")
+	mappingFile := f.String("mapping", "", "the file to write the column mapping for the import of the CSV")
+	if err := f.Parse(args); err != nil {
+		return 2
+	}
+
+	var err error
+	switch {
+	case e.measurement.Name == "":
+		err = errors.New("--measurement is required")
+	case *format != "lp" && *format != "csv":
+		err = fmt.Errorf("unknown format %q, expecting lp or csv", *format)
+	case *mappingFile != "" && *format != "csv":
+		err = errors.New("--mapping is only for --format csv")
+	}
+	if err == nil {
+		e.start, err = parseTimeFlag("start", *start)
+	}
+	if err == nil {
+		e.end, err = parseTimeFlag("end", *end)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	if e.cli, err = connectCli(); err != nil {
+		fmt.Fprintln(stderr, "ERR:", err)
+		return 1
+	}
+	defer e.cli.Close()
+
+	w := stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintln(stderr, "ERR:", err)
+			return 1
+		}
+		defer file.Close()
+		w = file
+	}
+
+	n, err := e.export(w, *format, *mappingFile)
+	fmt.Fprintf(stderr, "exported %d points\n", n)
+	if err != nil {
+		fmt.Fprintln(stderr, "ERR:", err)
+		return 1
+	}
+	return 0
+}
+
+func parseTimeFlag(name, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return t, fmt.Errorf("bad --%s %q, expecting RFC3339", name, value)
+	}
+	return t, nil
+}
+
+// exporter dumps the points of a measurement in the time range.
+type exporter struct {
+	cli         *influx.Cli
+	measurement influx.MeasurementMeta
+	start, end  time.Time
+	chunkSize   int
+
+	tagKeys    []string
+	fieldKeys  []string
+	fieldTypes map[string]string
+}
+
+// schema queries the tag keys and the field keys with their types of the measurement.
+func (e *exporter) schema() error {
+	var tagKeys []struct {
+		TagKey string `influx:"tagKey"`
+	}
+	if err := e.cli.DecodeQuery("SHOW TAG KEYS FROM "+e.measurement.Qualified(), &tagKeys); err != nil {
+		return err
+	}
+	for _, k := range tagKeys {
+		e.tagKeys = append(e.tagKeys, k.TagKey)
+	}
+
+	var fieldKeys []struct {
+		FieldKey  string `influx:"fieldKey"`
+		FieldType string `influx:"fieldType"`
+	}
+	if err := e.cli.DecodeQuery("SHOW FIELD KEYS FROM "+e.measurement.Qualified(), &fieldKeys); err != nil {
+		return err
+	}
+	e.fieldTypes = make(map[string]string)
+	for _, k := range fieldKeys {
+		e.fieldKeys = append(e.fieldKeys, k.FieldKey)
+		e.fieldTypes[k.FieldKey] = k.FieldType
+	}
+	if len(e.fieldKeys) == 0 {
+		return fmt.Errorf("measurement %s not found", e.measurement.Qualified())
+	}
+	return nil
+}
+
+func (e *exporter) query() string {
+	var conds []string
+	if !e.start.IsZero() {
+		conds = append(conds, "time >= '"+e.start.UTC().Format(time.RFC3339Nano)+"'")
+	}
+	if !e.end.IsZero() {
+		conds = append(conds, "time < '"+e.end.UTC().Format(time.RFC3339Nano)+"'")
+	}
+
+	q := "SELECT * FROM " + e.measurement.Qualified()
+	if len(conds) > 0 {
+		q += " WHERE " + strings.Join(conds, " AND ")
+	}
+	// GROUP BY * separates the tags from the fields
+	return q + " GROUP BY *"
+}
+
+// export writes the points in the format, and the mapping for the import of the CSV if mappingFile is not empty.
+func (e *exporter) export(w io.Writer, format, mappingFile string) (n int, err error) {
+	if err := e.schema(); err != nil {
+		return 0, err
+	}
+
+	bw := bufio.NewWriter(w)
+	var write func(s models.Row, values []interface{}) error
+	flush := bw.Flush
+	if format == "csv" {
+		if mappingFile != "" {
+			if err := e.mapping().save(mappingFile); err != nil {
+				return 0, err
+			}
+		}
+		cw := csv.NewWriter(bw)
+		if err := cw.Write(append(append([]string{"time"}, e.tagKeys...), e.fieldKeys...)); err != nil {
+			return 0, err
+		}
+		write = func(s models.Row, values []interface{}) error { return e.writeCSV(cw, s, values) }
+		flush = func() error {
+			if cw.Flush(); cw.Error() != nil {
+				return cw.Error()
+			}
+			return bw.Flush()
+		}
+	} else {
+		write = func(s models.Row, values []interface{}) error { return e.writeLine(bw, s, values) }
+	}
+
+	err = e.cli.QueryChunked(e.query(), e.chunkSize, func(series []models.Row) error {
+		for _, s := range series {
+			for _, values := range s.Values {
+				if err := write(s, values); err != nil {
+					return err
+				}
+				n++
+			}
+		}
+		return nil
+	}, influx.WithEpoch("ns"))
+	if err != nil {
+		return n, err
+	}
+	return n, flush()
+}
+
+func (e *exporter) mapping() *mapping {
+	m := &mapping{Measurement: e.measurement.Name, Time: "time", Columns: make(map[string]string)}
+	for _, k := range e.tagKeys {
+		m.Columns[k] = "tag"
+	}
+	for k, t := range e.fieldTypes {
+		m.Columns[k] = t
+	}
+	return m
+}
+
+func (e *exporter) writeLine(w io.Writer, s models.Row, values []interface{}) error {
+	var ts time.Time
+	fields := make(map[string]interface{})
+	for i, c := range s.Columns {
+		switch {
+		case values[i] == nil:
+		case c == "time":
+			ns, err := epochNanos(values[i])
+			if err != nil {
+				return err
+			}
+			ts = time.Unix(0, ns)
+		default:
+			v, err := fieldValue(values[i], e.fieldTypes[c])
+			if err != nil {
+				return fmt.Errorf("field %s: %w", c, err)
+			}
+			fields[c] = v
+		}
+	}
+
+	tags := make(map[string]string)
+	for k, v := range s.Tags {
+		if v != "" {
+			tags[k] = v
+		}
+	}
+
+	p, err := models.NewPoint(s.Name, models.NewTags(tags), fields, ts)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, p.String()+"\n")
+	return err
+}
+
+func (e *exporter) writeCSV(w *csv.Writer, s models.Row, values []interface{}) error {
+	columns := make(map[string]interface{})
+	for i, c := range s.Columns {
+		columns[c] = values[i]
+	}
+
+	ns, err := epochNanos(columns["time"])
+	if err != nil {
+		return err
+	}
+	record := []string{time.Unix(0, ns).UTC().Format(time.RFC3339Nano)}
+	for _, k := range e.tagKeys {
+		record = append(record, s.Tags[k])
+	}
+	for _, k := range e.fieldKeys {
+		record = append(record, formatValue(columns[k]))
+	}
+	return w.Write(record)
+}
+
+func epochNanos(v interface{}) (int64, error) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("unexpected time %v", v)
+	}
+	return n.Int64()
+}
+
+// fieldValue converts the value in the JSON response to the field type.
+func fieldValue(v interface{}, fieldType string) (interface{}, error) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return v, nil
+	}
+
+	switch fieldType {
+	case "integer":
+		return n.Int64()
+	case "unsigned":
+		return strconv.ParseUint(n.String(), 10, 64)
+	default:
+		return n.Float64()
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bingoohuang/influx/influxtest"
+)
+
+func TestExportImport(t *testing.T) {
+	s := influxtest.NewServer("db", "lp", "csv", "jsonl")
+	t.Cleanup(s.Close)
+	lines := []string{
+		`cpu,host=a,region=us count=1i,note="x y",ok=true,usage=1.5 1638000000000000000`,
+		`cpu,host=b count=2i,usage=2 1638000060000000000`,
+		`cpu,host=a usage=3 1638000120000000000`,
+	}
+	if err := s.WriteLines("db", strings.Join(lines, "\n")); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	lp, csvFile, mapping := filepath.Join(dir, "cpu.lp"), filepath.Join(dir, "cpu.csv"), filepath.Join(dir, "mapping.json")
+
+	// the line protocol
+	if _, errOut, code := runCLI(t, "", "export", "--dsn="+s.URL+"/db", "--measurement=cpu",
+		"--start=2021-11-27T08:00:00Z", "--end=2021-11-27T08:02:00Z", "--chunk-size=1", "--output="+lp); code != 0 || errOut != "exported 2 points\n" {
+		t.Fatalf("export: %d %s", code, errOut)
+	}
+	if _, errOut, code := runCLI(t, "", "import", "--dsn="+s.URL+"/lp", "--batch-size=1", lp); code != 0 {
+		t.Fatalf("import: %d %s", code, errOut)
+	}
+	if got := s.Lines("lp"); !reflect.DeepEqual(got, lines[:2]) {
+		t.Errorf("unexpected lines %q", got)
+	}
+
+	// the CSV with the mapping
+	out, errOut, code := runCLI(t, "", "export", "--dsn="+s.URL+"/db", "--measurement=cpu", "--format=csv", "--mapping="+mapping)
+	expected := `time,host,region,count,note,ok,usage
+2021-11-27T08:02:00Z,a,,,,,3
+2021-11-27T08:00:00Z,a,us,1,x y,true,1.5
+2021-11-27T08:01:00Z,b,,2,,,2
+`
+	if code != 0 || out != expected {
+		t.Fatalf("export csv: %d %s\n%s", code, errOut, out)
+	}
+	if err := os.WriteFile(csvFile, []byte(out), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, errOut, code := runCLI(t, "", "import", "--dsn="+s.URL+"/csv", "--mapping="+mapping, csvFile); code != 0 {
+		t.Fatalf("import csv: %d %s", code, errOut)
+	}
+	if got := s.Lines("csv"); !reflect.DeepEqual(got, s.Lines("db")) {
+		t.Errorf("unexpected lines %q", got)
+	}
+
+	// the jsonl of the query output, resumed from the offset
+	out, _, _ = runCLI(t, "", "--dsn="+s.URL+"/db", "--format=jsonl", "--epoch=s", `SELECT usage FROM cpu GROUP BY host`)
+	offset := filepath.Join(dir, "offset")
+	if err := os.WriteFile(offset, []byte("1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, errOut, code = runCLI(t, out, "import", "--dsn="+s.URL+"/jsonl", "--format=jsonl", "--precision=s", "--offset-file="+offset)
+	if code != 0 || !strings.HasPrefix(errOut, "resumed from record 2\nimported 2 points of 3 records") {
+		t.Fatalf("import jsonl: %d %s", code, errOut)
+	}
+	expectedLines := []string{"cpu,host=a usage=3 1638000120000000000", "cpu,host=b usage=2 1638000060000000000"}
+	if got := s.Lines("jsonl"); !reflect.DeepEqual(got, expectedLines) {
+		t.Errorf("unexpected lines %q", got)
+	}
+	if data, _ := os.ReadFile(offset); string(data) != "3\n" {
+		t.Errorf("unexpected offset %q", data)
+	}
+
+	// the bad record stops the import, after the records before imported
+	_, errOut, code = runCLI(t, "cpu v=1 1\ncpu v=\ncpu v=3 3\n", "import", "--dsn="+s.URL+"/lp", "--offset-file="+offset+"2")
+	if data, _ := os.ReadFile(offset + "2"); code != 1 || !strings.Contains(errOut, "record 2:") || string(data) != "1\n" {
+		t.Errorf("unexpected import of the bad record: %d %s %q", code, errOut, data)
+	}
+}
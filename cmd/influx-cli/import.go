@@ -0,0 +1,505 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bingoohuang/influx"
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+func runImport(args []string, stdin io.Reader, stderr io.Writer) int {
+	f := flag.NewFlagSet("influx-cli import", flag.ContinueOnError)
+	f.SetOutput(stderr)
+	f.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: influx-cli import [flags] [file], imports line protocol, CSV or jsonl, from stdin without the file")
+		f.PrintDefaults()
+	}
+
+	im := &importer{out: stderr}
+	connectCli := connectFlags(f)
+	format := f.String("format", "", "the input format, lp (line protocol), csv or jsonl, by the file extension by default")
+	measurement := f.String("measurement", "", "the measurement of the CSV or jsonl records, overriding the one of the mapping")
+	mappingFile := f.String("mapping", "", "the JSON file mapping the CSV columns or the jsonl keys to the tags and the fields")
+	precision := f.String("precision", "ns", "the precision of the epoch timestamps, ns, us, ms, s, m or h")
+	f.IntVar(&im.batchSize, "batch-size", 5000, "the points per write")
+	f.StringVar(&im.offsetFile, "offset-file", "", "the file to keep the number of the imported records, to resume from")
+	f.DurationVar(&im.progress, "progress", 5*time.Second, "the interval to report the progress")
+	if err := f.Parse(args); err != nil {
+		return 2
+	}
+
+	file := f.Arg(0)
+	if *format == "" {
+		*format = strings.TrimPrefix(filepath.Ext(file), ".")
+	}
+	m, err := loadMapping(*mappingFile)
+	if err == nil {
+		if *measurement != "" {
+			m.Measurement = *measurement
+		}
+		m.precision, err = precisionOf(*precision)
+	}
+	if err == nil && im.batchSize <= 0 {
+		err = errors.New("--batch-size should be positive")
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	in := stdin
+	if file != "" && file != "-" {
+		fd, err := os.Open(file)
+		if err != nil {
+			fmt.Fprintln(stderr, "ERR:", err)
+			return 1
+		}
+		defer fd.Close()
+		in = fd
+	}
+
+	switch *format {
+	case "lp", "txt", "":
+		// models takes u for microseconds
+		im.src = &lineSource{scanner: newScanner(in), precision: strings.Replace(*precision, "us", "u", 1)}
+	case "csv":
+		im.src, err = newCSVSource(in, m)
+	case "jsonl", "json":
+		im.src = &jsonlSource{scanner: newScanner(in), mapping: m}
+	default:
+		fmt.Fprintf(stderr, "unknown format %q, expecting lp, csv or jsonl\n", *format)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "ERR:", err)
+		return 1
+	}
+
+	if im.cli, err = connectCli(); err != nil {
+		fmt.Fprintln(stderr, "ERR:", err)
+		return 1
+	}
+	defer im.cli.Close()
+
+	if err := im.run(); err != nil {
+		fmt.Fprintln(stderr, "ERR:", err)
+		return 1
+	}
+	return 0
+}
+
+func newScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16*1024*1024)
+	return scanner
+}
+
+// precisions are the multipliers of the epoch timestamp precisions to nanoseconds.
+var precisions = map[string]int64{
+	"ns": 1, "us": 1e3, "ms": 1e6, "s": 1e9, "m": 60e9, "h": 3600e9,
+}
+
+func precisionOf(precision string) (int64, error) {
+	if multiplier, ok := precisions[precision]; ok {
+		return multiplier, nil
+	}
+	return 0, fmt.Errorf("unknown precision %q, expecting ns, us, ms, s, m or h", precision)
+}
+
+// mapping maps the CSV columns or the jsonl keys to the tags and the fields, as written by export --mapping, e.g.
+//
+//	{"measurement": "cpu", "time": "time", "columns": {"host": "tag", "usage": "float", "note": "-"}}
+type mapping struct {
+	// Measurement is the measurement of the records, unless mapped from a column.
+	Measurement string `json:"measurement,omitempty"`
+	// Time is the time column in RFC3339 or the epoch, time by default.
+	Time string `json:"time,omitempty"`
+	// Columns are the types of the columns, measurement, tag, float, integer, unsigned, string, boolean, or - to ignore.
+	// The unmapped columns are the fields, with the types inferred.
+	Columns map[string]string `json:"columns,omitempty"`
+
+	precision int64
+}
+
+var columnTypes = []string{"measurement", "tag", "float", "integer", "unsigned", "string", "boolean", "-"}
+
+func loadMapping(file string) (*mapping, error) {
+	m := &mapping{}
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, m); err != nil {
+			return nil, fmt.Errorf("bad mapping %s: %w", file, err)
+		}
+	}
+
+	if m.Time == "" {
+		m.Time = "time"
+	}
+	for column, typ := range m.Columns {
+		if !contains(columnTypes, typ) {
+			return nil, fmt.Errorf("unknown type %q of column %s, expecting one of %s", typ, column, strings.Join(columnTypes, ", "))
+		}
+	}
+	return m, nil
+}
+
+func (m *mapping) save(file string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, append(data, '\n'), 0o644)
+}
+
+// set sets the column of the point, the value is a string of CSV, or a JSON value of jsonl.
+func (m *mapping) set(p *influx.Point, column string, value interface{}) error {
+	if value == nil || value == "" {
+		return nil
+	}
+
+	typ := m.Columns[column]
+	s, isString := value.(string)
+	if !isString {
+		s = fmt.Sprint(value)
+	}
+
+	switch {
+	case typ == "-":
+		return nil
+	case column == m.Time:
+		t, err := m.parseTime(s)
+		p.Time = t
+		return err
+	case typ == "measurement":
+		p.Measurement = s
+		return nil
+	case typ == "tag":
+		p.Tags[column] = s
+		return nil
+	}
+
+	var v interface{}
+	var err error
+	switch typ {
+	case "float":
+		v, err = strconv.ParseFloat(s, 64)
+	case "integer":
+		v, err = strconv.ParseInt(s, 10, 64)
+	case "unsigned":
+		v, err = strconv.ParseUint(s, 10, 64)
+	case "boolean":
+		v, err = strconv.ParseBool(s)
+	case "string":
+		v = s
+	default:
+		v = inferValue(value, s, isString)
+	}
+	if err != nil {
+		return fmt.Errorf("column %s: %w", column, err)
+	}
+	p.Fields[column] = v
+	return nil
+}
+
+// inferValue infers the field value of the unmapped column, the numbers are floats.
+func inferValue(value interface{}, s string, isString bool) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+	case bool:
+		return v
+	}
+	if !isString {
+		return s
+	}
+
+	// the CSV cells
+	if f, err := strconv.ParseFloat(s, 64); err == nil && !math.IsNaN(f) && !math.IsInf(f, 0) {
+		return f
+	}
+	if s == "true" || s == "false" {
+		return s == "true"
+	}
+	return s
+}
+
+func (m *mapping) parseTime(s string) (time.Time, error) {
+	if epoch, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(0, epoch*m.precision), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return t, fmt.Errorf("bad time %q, expecting RFC3339 or the epoch", s)
+	}
+	return t, nil
+}
+
+func (m *mapping) newPoint() *influx.Point {
+	return &influx.Point{Measurement: m.Measurement, Tags: make(map[string]string), Fields: make(map[string]interface{})}
+}
+
+func (m *mapping) check(p *influx.Point) error {
+	if p.Measurement == "" {
+		return errors.New("no measurement, specified by --measurement or the mapping")
+	}
+	if len(p.Fields) == 0 {
+		return errors.New("no fields")
+	}
+	return nil
+}
+
+// source reads the records.
+type source interface {
+	// next returns the point of the next record, nil for the records without points like the comments,
+	// or io.EOF at the end.
+	next() (*influx.Point, error)
+}
+
+// lineSource reads the line protocol.
+type lineSource struct {
+	scanner   *bufio.Scanner
+	precision string
+}
+
+func (s *lineSource) next() (*influx.Point, error) {
+	if !s.scanner.Scan() {
+		if err := s.scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+
+	line := bytes.TrimSpace(s.scanner.Bytes())
+	if len(line) == 0 || line[0] == '#' {
+		return nil, nil
+	}
+
+	points, err := models.ParsePointsWithPrecision(line, time.Now().UTC(), s.precision)
+	if err != nil {
+		return nil, err
+	}
+	mp := points[0]
+	fields, err := mp.Fields()
+	if err != nil {
+		return nil, err
+	}
+	return &influx.Point{Measurement: string(mp.Name()), Tags: mp.Tags().Map(), Fields: fields, Time: mp.Time()}, nil
+}
+
+// csvSource reads the CSV with the header.
+type csvSource struct {
+	reader  *csv.Reader
+	header  []string
+	mapping *mapping
+}
+
+func newCSVSource(r io.Reader, m *mapping) (*csvSource, error) {
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read the CSV header: %w", err)
+	}
+	return &csvSource{reader: reader, header: append([]string(nil), header...), mapping: m}, nil
+}
+
+func (s *csvSource) next() (*influx.Point, error) {
+	record, err := s.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	p := s.mapping.newPoint()
+	for i, column := range s.header {
+		if i < len(record) {
+			if err := s.mapping.set(p, column, record[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return p, s.mapping.check(p)
+}
+
+// jsonlSource reads the JSON objects per line, like the output of the query in the jsonl format,
+// with the measurement by the name key and the tags object.
+type jsonlSource struct {
+	scanner *bufio.Scanner
+	mapping *mapping
+}
+
+func (s *jsonlSource) next() (*influx.Point, error) {
+	if !s.scanner.Scan() {
+		if err := s.scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+
+	line := bytes.TrimSpace(s.scanner.Bytes())
+	if len(line) == 0 {
+		return nil, nil
+	}
+
+	var obj map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	if err := dec.Decode(&obj); err != nil {
+		return nil, err
+	}
+
+	p := s.mapping.newPoint()
+	for k, v := range obj {
+		switch vv := v.(type) {
+		case map[string]interface{}:
+			if k != "tags" {
+				return nil, fmt.Errorf("unexpected object of key %s", k)
+			}
+			for tk, tv := range vv {
+				if tv, ok := tv.(string); ok && tv != "" {
+					p.Tags[tk] = tv
+				}
+			}
+		case string:
+			if k == "name" && s.mapping.Columns[k] == "" {
+				if p.Measurement == "" {
+					p.Measurement = vv
+				}
+				continue
+			}
+			if err := s.mapping.set(p, k, v); err != nil {
+				return nil, err
+			}
+		default:
+			if err := s.mapping.set(p, k, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return p, s.mapping.check(p)
+}
+
+// importer writes the points of the source in batches, and keeps the number of the imported records
+// in the offset file to resume from.
+type importer struct {
+	cli        *influx.Cli
+	src        source
+	batchSize  int
+	offsetFile string
+	progress   time.Duration
+	out        io.Writer
+
+	records  int
+	points   int
+	batch    []influx.Point
+	start    time.Time
+	reported time.Time
+}
+
+func (im *importer) run() error {
+	im.start = time.Now()
+	im.reported = im.start
+	if err := im.skip(); err != nil {
+		return err
+	}
+
+	for {
+		p, err := im.src.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// the records before are imported to resume from the bad one
+			if ferr := im.flush(); ferr != nil {
+				return ferr
+			}
+			return fmt.Errorf("record %d: %w", im.records+1, err)
+		}
+
+		im.records++
+		if p != nil {
+			im.batch = append(im.batch, *p)
+		}
+		if len(im.batch) >= im.batchSize {
+			if err := im.flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := im.flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(im.out, "imported %d points of %d records in %s\n", im.points, im.records, time.Since(im.start).Round(time.Millisecond))
+	return nil
+}
+
+// skip skips the records imported before by the offset file.
+func (im *importer) skip() error {
+	if im.offsetFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(im.offsetFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	offset, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return fmt.Errorf("bad offset file %s: %w", im.offsetFile, err)
+	}
+
+	for ; im.records < offset; im.records++ {
+		if _, err := im.src.next(); err != nil {
+			return fmt.Errorf("skip %d records by the offset file %s: %w", offset, im.offsetFile, err)
+		}
+	}
+	if offset > 0 {
+		fmt.Fprintf(im.out, "resumed from record %d\n", offset+1)
+	}
+	return nil
+}
+
+// flush writes the batch, saves the offset and reports the progress.
+func (im *importer) flush() error {
+	if len(im.batch) > 0 {
+		if err := im.cli.WritePointsRaw(im.batch); err != nil {
+			return fmt.Errorf("write records before %d: %w", im.records+1, err)
+		}
+		im.points += len(im.batch)
+		im.batch = im.batch[:0]
+	}
+
+	if im.offsetFile != "" {
+		if err := os.WriteFile(im.offsetFile, []byte(strconv.Itoa(im.records)+"\n"), 0o644); err != nil {
+			return err
+		}
+	}
+
+	if now := time.Now(); im.progress > 0 && now.Sub(im.reported) >= im.progress {
+		im.reported = now
+		elapsed := now.Sub(im.start)
+		fmt.Fprintf(im.out, "imported %d points of %d records, %.0f points/s\n", im.points, im.records,
+			float64(im.points)/elapsed.Seconds())
+	}
+	return nil
+}
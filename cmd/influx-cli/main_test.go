@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bingoohuang/influx/influxtest"
+)
+
+func newServer(t *testing.T) *influxtest.Server {
+	s := influxtest.NewServer("db")
+	t.Cleanup(s.Close)
+	lines := "cpu,host=a usage=1.5 1638000000000000000\ncpu,host=b usage=2 1638000060000000000"
+	if err := s.WriteLines("db", lines); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func runCLI(t *testing.T, stdin string, args ...string) (string, string, int) {
+	var out, errOut bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &out, &errOut)
+	return out.String(), errOut.String(), code
+}
+
+func TestFormats(t *testing.T) {
+	dsn := "--dsn=" + strings.Replace(newServer(t).URL, "http://", "influx://", 1) + "/db"
+	q := `SELECT usage, host FROM cpu`
+
+	cases := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{}, `name: cpu
+time                 usage host
+----                 ----- ----
+2021-11-27T08:00:00Z 1.5   a
+2021-11-27T08:01:00Z 2     b
+`},
+		{[]string{"--format=csv", "--epoch=s"}, `name,tags,time,usage,host
+cpu,,1638000000,1.5,a
+cpu,,1638000060,2,b
+`},
+		{[]string{"--format=json", "--epoch=ms", "--chunked"}, `[
+{"name":"cpu","time":1638000000000,"usage":1.5,"host":"a"},
+{"name":"cpu","time":1638000060000,"usage":2,"host":"b"}
+]
+`},
+		{[]string{"--format=jsonl"}, `{"name":"cpu","time":"2021-11-27T08:00:00Z","usage":1.5,"host":"a"}
+{"name":"cpu","time":"2021-11-27T08:01:00Z","usage":2,"host":"b"}
+`},
+	}
+	for _, c := range cases {
+		out, errOut, code := runCLI(t, "", append(append([]string{dsn}, c.args...), q)...)
+		if code != 0 || out != c.expected {
+			t.Errorf("%v: code %d, stderr %s, unexpected output:\n%s", c.args, code, errOut, out)
+		}
+	}
+
+	out, _, code := runCLI(t, "", dsn, "--tags", `SELECT * FROM cpu GROUP BY host`)
+	if code != 0 || !strings.Contains(out, "tags: host=b\n") || !strings.HasSuffix(out, "tags:\n  host: a, b\n") {
+		t.Errorf("unexpected output %d:\n%s", code, out)
+	}
+
+	if _, errOut, code := runCLI(t, "", dsn, "--tags", "--chunked", q); code != 2 || errOut == "" {
+		t.Errorf("expected the usage error, got %d %s", code, errOut)
+	}
+	if _, errOut, code := runCLI(t, "", dsn, `SELECT * FROM`); code != 1 || !strings.HasPrefix(errOut, "ERR: ") {
+		t.Errorf("expected the query error, got %d %s", code, errOut)
+	}
+}
+
+func TestREPL(t *testing.T) {
+	s := newServer(t)
+	history := filepath.Join(t.TempDir(), "history")
+	stdin := `
+use db
+format csv
+SELECT count(usage) FROM cpu
+format xml
+epoch ns
+!!
+!3
+history
+exit
+SHOW DATABASES
+`
+	out, errOut, code := runCLI(t, stdin, "--dsn="+s.URL, "--history="+history)
+	expected := `Using database db
+name,tags,time,count
+cpu,,1970-01-01T00:00:00Z,2
+epoch ns
+SELECT count(usage) FROM cpu
+name,tags,time,count
+cpu,,0,2
+   1  use db
+   2  format csv
+   3  SELECT count(usage) FROM cpu
+   4  format xml
+   5  epoch ns
+   6  SELECT count(usage) FROM cpu
+`
+	if code != 0 || out != expected || !strings.Contains(errOut, `unknown format "xml"`) {
+		t.Errorf("code %d, stderr %s, unexpected output:\n%s", code, errOut, out)
+	}
+
+	// the piped statements are not kept in the history file
+	if _, err := os.Stat(history); !os.IsNotExist(err) {
+		t.Errorf("expected no history file, got %v", err)
+	}
+}
+
+func TestHistoryFile(t *testing.T) {
+	history := filepath.Join(t.TempDir(), "history")
+	var lines []string
+	for i := 0; i < maxHistory+10; i++ {
+		lines = append(lines, fmt.Sprintf("SELECT %d", i))
+	}
+	if err := os.WriteFile(history, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &repl{historyFile: history}
+	r.loadHistory()
+	r.addHistory("SHOW DATABASES")
+
+	// the history is kept across the sessions, truncated to the max statements
+	r = &repl{historyFile: history}
+	r.loadHistory()
+	if len(r.history) != maxHistory || r.history[0] != "SELECT 11" || r.history[maxHistory-1] != "SHOW DATABASES" {
+		t.Errorf("unexpected history %d %q ... %q", len(r.history), r.history[0], r.history[len(r.history)-1])
+	}
+	data, err := os.ReadFile(history)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "\n"); n != maxHistory {
+		t.Errorf("expected %d lines in the history file, got %d", maxHistory, n)
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bingoohuang/influx"
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+// execute executes the query and prints the result, with the values of the tags if required.
+func execute(c influx.Querier, o *options, q string, out, errOut io.Writer) error {
+	p := newPrinter(o.format, out)
+	var queryOptions []influx.QueryOptionFn
+	if o.epoch != "" {
+		queryOptions = append(queryOptions, influx.WithEpoch(o.epoch))
+	}
+
+	if o.chunked {
+		if err := c.QueryChunked(q, o.chunkSize, p.print, queryOptions...); err != nil {
+			return err
+		}
+		return p.flush()
+	}
+
+	var tags map[string][]string
+	if o.tags {
+		queryOptions = append(queryOptions, influx.WithTagsReturn(&tags, o.tagsLimit),
+			influx.WithTagErrors(influx.TagErrorReturn))
+	}
+
+	var series []models.Row
+	err := c.DecodeQuery(q, &series, queryOptions...)
+	var tagErr *influx.TagLookupError
+	if err != nil && !errors.As(err, &tagErr) {
+		return err
+	}
+
+	if err := p.print(series); err != nil {
+		return err
+	}
+	if err := p.flush(); err != nil {
+		return err
+	}
+
+	if o.tags {
+		// the tags are kept out of the machine readable outputs
+		w := errOut
+		if o.format == "table" {
+			w = out
+		}
+		printTags(w, tags)
+	}
+	return err
+}
+
+func printTags(w io.Writer, tags map[string][]string) {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	fmt.Fprintln(w, "tags:")
+	for _, k := range keys {
+		fmt.Fprintf(w, "  %s: %s\n", k, strings.Join(tags[k], ", "))
+	}
+}
+
+// printer prints the series, maybe of several chunks.
+type printer interface {
+	print(series []models.Row) error
+	flush() error
+}
+
+func newPrinter(format string, w io.Writer) printer {
+	switch format {
+	case "csv":
+		return &csvPrinter{w: csv.NewWriter(w)}
+	case "json":
+		return &jsonPrinter{w: w}
+	case "jsonl":
+		return &jsonPrinter{w: w, lines: true}
+	default:
+		return &tablePrinter{w: w}
+	}
+}
+
+// tablePrinter prints each series as an aligned table, with the continued series of the next chunks appended.
+type tablePrinter struct {
+	w       io.Writer
+	tw      *tabwriter.Writer
+	last    string
+	printed bool
+}
+
+func (p *tablePrinter) print(series []models.Row) error {
+	for _, s := range series {
+		if key := seriesKey(s) + "\x00" + strings.Join(s.Columns, ","); p.tw == nil || key != p.last {
+			if err := p.flush(); err != nil {
+				return err
+			}
+			p.last = key
+			p.header(s)
+		}
+
+		for _, values := range s.Values {
+			cells := make([]string, len(values))
+			for i, v := range values {
+				cells[i] = formatValue(v)
+			}
+			fmt.Fprintln(p.tw, strings.Join(cells, "\t"))
+		}
+	}
+	return nil
+}
+
+func (p *tablePrinter) header(s models.Row) {
+	if p.printed {
+		fmt.Fprintln(p.w)
+	}
+	p.printed = true
+
+	if s.Name != "" {
+		fmt.Fprintf(p.w, "name: %s\n", s.Name)
+	}
+	if len(s.Tags) > 0 {
+		fmt.Fprintf(p.w, "tags: %s\n", formatTags(s.Tags, ", "))
+	}
+
+	p.tw = tabwriter.NewWriter(p.w, 0, 0, 1, ' ', 0)
+	lines := make([]string, len(s.Columns))
+	for i, c := range s.Columns {
+		lines[i] = strings.Repeat("-", len(c))
+	}
+	fmt.Fprintln(p.tw, strings.Join(s.Columns, "\t"))
+	fmt.Fprintln(p.tw, strings.Join(lines, "\t"))
+}
+
+func (p *tablePrinter) flush() error {
+	if p.tw == nil {
+		return nil
+	}
+	err := p.tw.Flush()
+	p.tw = nil
+	return err
+}
+
+// csvPrinter prints the rows with the name and the tags of the series, and the header whenever the columns change.
+type csvPrinter struct {
+	w       *csv.Writer
+	columns string
+}
+
+func (p *csvPrinter) print(series []models.Row) error {
+	for _, s := range series {
+		if columns := strings.Join(s.Columns, ","); columns != p.columns {
+			p.columns = columns
+			if err := p.w.Write(append([]string{"name", "tags"}, s.Columns...)); err != nil {
+				return err
+			}
+		}
+
+		tags := formatTags(s.Tags, ",")
+		for _, values := range s.Values {
+			record := []string{s.Name, tags}
+			for _, v := range values {
+				record = append(record, formatValue(v))
+			}
+			if err := p.w.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+	p.w.Flush()
+	return p.w.Error()
+}
+
+func (p *csvPrinter) flush() error {
+	p.w.Flush()
+	return p.w.Error()
+}
+
+// jsonPrinter prints the rows as the objects with the name, the tags and the columns in order,
+// in an array, or one per line for jsonl.
+type jsonPrinter struct {
+	w     io.Writer
+	lines bool
+	rows  int
+}
+
+func (p *jsonPrinter) print(series []models.Row) error {
+	for _, s := range series {
+		for _, values := range s.Values {
+			obj, err := rowJSON(s, values)
+			if err != nil {
+				return err
+			}
+
+			switch {
+			case p.lines:
+			case p.rows == 0:
+				_, err = io.WriteString(p.w, "[\n")
+			default:
+				_, err = io.WriteString(p.w, ",\n")
+			}
+			if err != nil {
+				return err
+			}
+			if p.lines {
+				obj = append(obj, '\n')
+			}
+			if _, err := p.w.Write(obj); err != nil {
+				return err
+			}
+			p.rows++
+		}
+	}
+	return nil
+}
+
+func (p *jsonPrinter) flush() error {
+	if p.lines {
+		return nil
+	}
+	end := "\n]\n"
+	if p.rows == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(p.w, end)
+	return err
+}
+
+func rowJSON(s models.Row, values []interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	write := func(k string, v interface{}) error {
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		kv, err := json.Marshal(k)
+		if err != nil {
+			return err
+		}
+		vv, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		b.Write(kv)
+		b.WriteByte(':')
+		b.Write(vv)
+		return nil
+	}
+
+	if s.Name != "" {
+		if err := write("name", s.Name); err != nil {
+			return nil, err
+		}
+	}
+	if len(s.Tags) > 0 {
+		if err := write("tags", s.Tags); err != nil {
+			return nil, err
+		}
+	}
+	for i, c := range s.Columns {
+		if i < len(values) {
+			if err := write(c, values[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+func seriesKey(s models.Row) string { return s.Name + "," + formatTags(s.Tags, ",") }
+
+func formatTags(tags map[string]string, sep string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + tags[k]
+	}
+	return strings.Join(pairs, sep)
+}
+
+func formatValue(v interface{}) string {
+	switch vv := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return vv
+	case json.Number:
+		return vv.String()
+	case float64:
+		return strconv.FormatFloat(vv, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/bingoohuang/influx"
+)
+
+const replHelp = `Commands:
+  use <db>           use the database
+  format <format>    set the output format, table, csv, json or jsonl
+  epoch [<epoch>]    print the time as the epoch in h, m, s, ms, u or ns, RFC3339 without the epoch
+  tags on|off        print the values of the tags in the result
+  chunked on|off     stream the result in chunks
+  history            print the history
+  !!, !<n>           execute the last or the nth statement in the history
+  help               print the help
+  exit, quit         exit
+The other lines are executed as InfluxQL.`
+
+// maxHistory is the max number of the statements kept in the history.
+const maxHistory = 1000
+
+// repl reads the statements line by line, executes them and prints the results.
+type repl struct {
+	cli         *influx.Cli
+	options     *options
+	in          io.Reader
+	out, errOut io.Writer
+	// historyFile keeps the history across the sessions, empty to disable.
+	historyFile string
+	// prompt tells to print the prompt, when reading from a terminal.
+	prompt bool
+
+	history []string
+	failed  bool
+}
+
+// run runs the REPL until exit or EOF, and returns the exit code, 1 when any statement failed without the prompt.
+func (r *repl) run() int {
+	r.loadHistory()
+	if r.prompt {
+		fmt.Fprintf(r.out, "Connected to %s database %s, \"help\" for the commands\n", r.cli.Addr, r.cli.DB)
+	}
+
+	scanner := bufio.NewScanner(r.in)
+	scanner.Buffer(nil, 16*1024*1024)
+	for {
+		if r.prompt {
+			fmt.Fprint(r.out, "> ")
+		}
+		if !scanner.Scan() {
+			break
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "!") {
+			if line = r.recall(line); line == "" {
+				continue
+			}
+		}
+		if r.handle(line) {
+			return 0
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintln(r.errOut, "ERR:", err)
+		return 1
+	}
+	if r.failed && !r.prompt {
+		return 1
+	}
+	return 0
+}
+
+// recall returns the statement of the history by !! or !<n>, or empty after printing the error.
+func (r *repl) recall(line string) string {
+	n := len(r.history)
+	if line != "!!" {
+		var err error
+		if n, err = strconv.Atoi(line[1:]); err != nil {
+			r.fail(fmt.Errorf("bad history reference %s", line))
+			return ""
+		}
+	}
+	if n < 1 || n > len(r.history) {
+		r.fail(fmt.Errorf("no statement %s in the history", line))
+		return ""
+	}
+
+	fmt.Fprintln(r.out, r.history[n-1])
+	return r.history[n-1]
+}
+
+// handle handles the command or executes the statement, and returns true to exit.
+func (r *repl) handle(line string) bool {
+	fields := strings.Fields(line)
+	cmd, args := strings.ToLower(fields[0]), fields[1:]
+	switch {
+	case cmd == "exit" || cmd == "quit":
+		return true
+	case cmd == "help":
+		fmt.Fprintln(r.out, replHelp)
+		return false
+	case cmd == "history":
+		for i, h := range r.history {
+			fmt.Fprintf(r.out, "%4d  %s\n", i+1, h)
+		}
+		return false
+	}
+
+	r.addHistory(line)
+	switch {
+	case cmd == "use" && len(args) == 1:
+		r.cli.UseDB(strings.Trim(args[0], `"`))
+		fmt.Fprintln(r.out, "Using database", r.cli.DB)
+	case cmd == "format" && len(args) == 1:
+		r.set(func(o *options) { o.format = args[0] })
+	case cmd == "epoch" && len(args) <= 1:
+		r.set(func(o *options) { o.epoch = strings.Join(args, "") })
+	case cmd == "tags" && len(args) == 1:
+		r.set(func(o *options) { o.tags = args[0] == "on" })
+	case cmd == "chunked" && len(args) == 1:
+		r.set(func(o *options) { o.chunked = args[0] == "on" })
+	default:
+		if err := execute(r.cli, r.options, line, r.out, r.errOut); err != nil {
+			r.fail(err)
+		}
+	}
+	return false
+}
+
+// set changes the options if valid.
+func (r *repl) set(f func(o *options)) {
+	o := *r.options
+	f(&o)
+	if err := o.validate(); err != nil {
+		r.fail(err)
+		return
+	}
+	*r.options = o
+}
+
+func (r *repl) fail(err error) {
+	r.failed = true
+	fmt.Fprintln(r.errOut, "ERR:", err)
+}
+
+func (r *repl) loadHistory() {
+	if r.historyFile == "" {
+		return
+	}
+	data, err := os.ReadFile(r.historyFile)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			r.history = append(r.history, line)
+		}
+	}
+	if len(r.history) > maxHistory {
+		// rewritten to the kept statements, not to grow by the appends forever
+		r.history = r.history[len(r.history)-maxHistory:]
+		_ = os.WriteFile(r.historyFile, []byte(strings.Join(r.history, "\n")+"\n"), 0o600)
+	}
+}
+
+func (r *repl) addHistory(line string) {
+	if n := len(r.history); n > 0 && r.history[n-1] == line {
+		return
+	}
+	r.history = append(r.history, line)
+	if len(r.history) > maxHistory {
+		r.history = r.history[1:]
+	}
+
+	if r.historyFile == "" {
+		return
+	}
+	f, err := os.OpenFile(r.historyFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	_, _ = fmt.Fprintln(f, line)
+}
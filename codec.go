@@ -35,26 +35,31 @@ func Encode(d interface{}) (p Point, err error) {
 
 	p.Tags = make(map[string]string)
 	p.Fields = make(map[string]interface{})
+	p.structFields = make(map[string]string)
 
 	dt := dv.Type()
 	var times []time.Time
 
 	for i := 0; i < dv.NumField(); i++ {
 		ft, fv := dt.Field(i), dv.Field(i)
+		fd := ParseInfluxTag(ft.Name, ft.Tag.Get("influx"))
 		if ft.Name == InfluxMeasurement {
-			p.Measurement = fv.String()
+			p.processMeasurementMarker(fd)
+			if v := fv.String(); v != "" {
+				p.Measurement = v
+			}
 			continue
 		}
 
-		fd := ParseInfluxTag(ft.Name, ft.Tag.Get("influx"))
-		if v := fd.Properties["measurement"]; v != "" {
-			p.Measurement = v
+		if fd.Properties["measurement"] != "" {
+			p.processMeasurementMarker(fd)
 			continue
 		}
 
 		if err = p.processField(fd, fv); err != nil {
 			return
 		}
+		p.structFields[fd.Name] = ft.Name
 
 		if p.Time.IsZero() && fv.CanConvert(timeType) {
 			if v, ok := fv.Convert(timeType).Interface().(time.Time); ok {
@@ -74,6 +79,21 @@ func Encode(d interface{}) (p Point, err error) {
 	return
 }
 
+// processMeasurementMarker reads the point level properties like `influx:",measurement:cpu,db:telegraf,rp:oneweek"`.
+func (p *Point) processMeasurementMarker(fd *Field) {
+	var m MeasurementMeta
+	m.parseMarker(fd)
+	if m.Name != "" {
+		p.Measurement = m.Name
+	}
+	if m.DB != "" {
+		p.DB = m.DB
+	}
+	if m.RetentionPolicy != "" {
+		p.RetentionPolicy = m.RetentionPolicy
+	}
+}
+
 func (p *Point) processField(fd *Field, f reflect.Value) error {
 	if fd.Name == "Time" || fd.Name == "time" {
 		if v, ok := f.Interface().(time.Time); ok {
@@ -117,16 +137,36 @@ func Decode(influxResult []models.Row, result interface{}) error {
 	return DecodeOption(influxResult, result, &QueryOption{})
 }
 
+// DecodeOption is like Decode, but with the query option applied.
+//
+// The shape of the decoded data depends on the type result points to:
+//   - *[]T where T is a struct or map: one element per row of all series.
+//   - *T where T is a struct or map: the first row only.
+//   - *[]T where T is a scalar like float64, int64 or string: the single value column
+//     (the time column excluded) of every row, e.g. SELECT count(x) ... GROUP BY time(1m).
+//   - *T where T is a scalar: the single value column of the only row, e.g. SELECT count(x).
+//   - *[]models.Row: the series as they are, e.g. to print them generically.
+//
+// A *ShapeError is returned when the result does not fit the scalar destinations.
 func DecodeOption(influxResult []models.Row, result interface{}, option *QueryOption) error {
-	influxRows := make([]map[string]interface{}, 0)
+	rv := reflect.ValueOf(result)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("result must be a non-nil pointer")
+	}
+
+	collectTags(influxResult, option)
 
-	tagCollector := makeTagsCollector(option)
+	if rows, ok := result.(*[]models.Row); ok {
+		*rows = influxResult
+		return nil
+	}
+
+	influxRows := make([]map[string]interface{}, 0)
 	for _, series := range influxResult {
 		for _, values := range series.Values {
 			row := make(map[string]interface{})
 			for i, columnName := range series.Columns {
 				row[columnName] = values[i]
-				tagCollector.collect(columnName, values[i])
 			}
 			for tag, val := range series.Tags {
 				row[tag] = val
@@ -136,12 +176,18 @@ func DecodeOption(influxResult []models.Row, result interface{}, option *QueryOp
 		}
 	}
 
-	tagCollector.complete(option.ReturnTags)
-
 	if len(influxRows) == 0 {
+		if option.Strict {
+			return checkStrict(influxResult, result, &mapstruct.Metadata{})
+		}
 		return nil
 	}
 
+	input, err := decodeInput(influxResult, influxRows, rv.Type().Elem())
+	if err != nil {
+		return err
+	}
+
 	config := &mapstruct.Config{
 		Metadata:   &mapstruct.Metadata{},
 		Result:     result,
@@ -168,7 +214,89 @@ func DecodeOption(influxResult []models.Row, result interface{}, option *QueryOp
 		return err
 	}
 
-	return decoder.Decode(influxRows)
+	if err := decoder.Decode(input); err != nil {
+		return wrapDecodeError(err)
+	}
+
+	if option.Strict {
+		return checkStrict(influxResult, result, config.Metadata)
+	}
+
+	return nil
+}
+
+// ShapeError tells the query result does not fit the shape of the decoding destination.
+type ShapeError struct {
+	Dest    reflect.Type
+	Columns []string
+	Rows    int
+}
+
+func (e *ShapeError) Error() string {
+	return fmt.Sprintf("cannot decode %d row(s) with value columns %v into %s, "+
+		"a single value column is required (and a single row for a non-slice destination)", e.Rows, e.Columns, e.Dest)
+}
+
+// decodeInput shapes the rows according to the destination type dest.
+func decodeInput(influxResult []models.Row, influxRows []map[string]interface{}, dest reflect.Type) (interface{}, error) {
+	switch {
+	case dest.Kind() == reflect.Map, dest.Kind() == reflect.Struct:
+		return influxRows[0], nil
+	case isScalar(dest):
+		values, err := scalarValues(influxResult, dest)
+		if err != nil {
+			return nil, err
+		}
+		if len(values) != 1 {
+			return nil, &ShapeError{Dest: dest, Columns: valueColumns(influxResult[0]), Rows: len(values)}
+		}
+		return values[0], nil
+	case dest.Kind() == reflect.Slice && isScalar(dest.Elem()):
+		return scalarValues(influxResult, dest)
+	default:
+		return influxRows, nil
+	}
+}
+
+func isScalar(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// valueColumns returns the columns of the series except the time column.
+func valueColumns(series models.Row) []string {
+	columns := make([]string, 0, len(series.Columns))
+	for _, c := range series.Columns {
+		if c != "time" {
+			columns = append(columns, c)
+		}
+	}
+	return columns
+}
+
+// scalarValues collects the single value column of every row of all series.
+func scalarValues(influxResult []models.Row, dest reflect.Type) ([]interface{}, error) {
+	var values []interface{}
+	for _, series := range influxResult {
+		columns := valueColumns(series)
+		if len(columns) != 1 {
+			return nil, &ShapeError{Dest: dest, Columns: columns, Rows: len(series.Values)}
+		}
+		for _, row := range series.Values {
+			for i, c := range series.Columns {
+				if c == columns[0] {
+					values = append(values, row[i])
+				}
+			}
+		}
+	}
+	return values, nil
 }
 
 type Field struct {
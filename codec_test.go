@@ -2,6 +2,7 @@ package influx_test
 
 import (
 	"encoding/json"
+	"errors"
 	"math"
 	"reflect"
 	"strconv"
@@ -403,3 +404,363 @@ func TestTag(t *testing.T) {
 		}
 	}
 }
+
+func TestDecodeStrict(t *testing.T) {
+	data := models.Row{
+		Name:    "bla",
+		Columns: []string{"val1", "val3"},
+		Values:  [][]interface{}{{1, 3}},
+		Tags:    map[string]string{"host": "h1"},
+	}
+
+	type DecodeType struct {
+		Val1 int    `influx:"val1"`
+		Val2 int    `influx:"val2,required"`
+		Host string `influx:"host,tag,required"`
+	}
+
+	var decoded []DecodeType
+	err := influx.DecodeOption([]models.Row{data}, &decoded, &influx.QueryOption{Strict: true})
+
+	var se *influx.StrictDecodeError
+	if !errors.As(err, &se) {
+		t.Fatalf("expected *StrictDecodeError, got %v", err)
+	}
+	if !reflect.DeepEqual(se.UnmappedColumns, []string{"val3"}) {
+		t.Errorf("unmapped columns %v", se.UnmappedColumns)
+	}
+	if !reflect.DeepEqual(se.MissingFields, []string{"val2"}) {
+		t.Errorf("missing fields %v", se.MissingFields)
+	}
+	if !reflect.DeepEqual(decoded, []DecodeType{{Val1: 1, Host: "h1"}}) {
+		t.Errorf("decoded Value is not right %v", decoded)
+	}
+
+	decoded = nil
+	data.Columns, data.Values = []string{"val1", "val2"}, [][]interface{}{{1, 2}}
+	if err := influx.DecodeOption([]models.Row{data}, &decoded, &influx.QueryOption{Strict: true}); err != nil {
+		t.Error("Unexpected error decoding: ", err)
+	}
+}
+
+func TestDecodeStrictNested(t *testing.T) {
+	type Base struct {
+		Host string `influx:"host,tag,required"`
+	}
+	type Load struct {
+		Load1 float64 `influx:"load1,required"`
+	}
+	type DecodeType struct {
+		Base
+		Load Load `influx:",squash"`
+		Val1 int  `influx:"val1"`
+	}
+
+	data := models.Row{
+		Name:    "bla",
+		Columns: []string{"val1"},
+		Values:  [][]interface{}{{1}},
+		Tags:    map[string]string{"host": "h1"},
+	}
+	var decoded []DecodeType
+	err := influx.DecodeOption([]models.Row{data}, &decoded, &influx.QueryOption{Strict: true})
+	var se *influx.StrictDecodeError
+	if !errors.As(err, &se) || !reflect.DeepEqual(se.MissingFields, []string{"load1"}) {
+		t.Fatalf("expected the missing load1 of the squashed struct, got %v", err)
+	}
+
+	// the empty result misses all the required fields
+	decoded = nil
+	err = influx.DecodeOption(nil, &decoded, &influx.QueryOption{Strict: true})
+	if !errors.As(err, &se) || !reflect.DeepEqual(se.MissingFields, []string{"host", "load1"}) {
+		t.Fatalf("expected the missing host and load1 of the empty result, got %v", err)
+	}
+	if err := influx.DecodeOption(nil, &decoded, &influx.QueryOption{}); err != nil {
+		t.Errorf("unexpected error of the empty result without strict: %v", err)
+	}
+}
+
+func TestDecodeDestinations(t *testing.T) {
+	data := []models.Row{{
+		Name:    "bla",
+		Columns: []string{"time", "val1", "val2"},
+		Values: [][]interface{}{
+			{"2018-06-14T21:47:11Z", json.Number("1"), "a"},
+			{"2018-06-14T21:48:11Z", json.Number("2"), "b"},
+		},
+		Tags: map[string]string{"host": "h1"},
+	}}
+
+	var rows []map[string]interface{}
+	if err := influx.Decode(data, &rows); err != nil {
+		t.Fatal("Error decoding: ", err)
+	}
+	if len(rows) != 2 || rows[1]["val2"] != "b" || rows[1]["host"] != "h1" {
+		t.Errorf("decoded Value is not right %v", rows)
+	}
+
+	var first map[string]string
+	if err := influx.Decode(data, &first); err != nil {
+		t.Fatal("Error decoding: ", err)
+	}
+	if first["val1"] != "1" || first["val2"] != "a" || first[influx.InfluxMeasurement] != "bla" {
+		t.Errorf("decoded Value is not right %v", first)
+	}
+
+	type DecodeType struct {
+		Val1 int    `influx:"val1"`
+		Val2 string `influx:"val2"`
+	}
+	var one DecodeType
+	if err := influx.Decode(data, &one); err != nil {
+		t.Fatal("Error decoding: ", err)
+	}
+	if one != (DecodeType{1, "a"}) {
+		t.Errorf("decoded Value is not right %v", one)
+	}
+
+	var shapeErr *influx.ShapeError
+	var floats []float64
+	if err := influx.Decode(data, &floats); !errors.As(err, &shapeErr) {
+		t.Errorf("expected *ShapeError, got %v", err)
+	}
+}
+
+func TestDecodeScalar(t *testing.T) {
+	data := []models.Row{{
+		Name:    "bla",
+		Columns: []string{"time", "count"},
+		Values:  [][]interface{}{{"1970-01-01T00:00:00Z", json.Number("42")}},
+	}}
+
+	var f float64
+	if err := influx.Decode(data, &f); err != nil || f != 42 {
+		t.Errorf("decoded Value is not right %v %v", f, err)
+	}
+
+	var i int64
+	if err := influx.Decode(data, &i); err != nil || i != 42 {
+		t.Errorf("decoded Value is not right %v %v", i, err)
+	}
+
+	data[0].Values = append(data[0].Values, []interface{}{"1970-01-01T00:01:00Z", json.Number("43.5")})
+	var fs []float64
+	if err := influx.Decode(data, &fs); err != nil || !reflect.DeepEqual(fs, []float64{42, 43.5}) {
+		t.Errorf("decoded Value is not right %v %v", fs, err)
+	}
+
+	var shapeErr *influx.ShapeError
+	if err := influx.Decode(data, &f); !errors.As(err, &shapeErr) {
+		t.Errorf("expected *ShapeError, got %v", err)
+	}
+}
+
+func TestDecodeGrouped(t *testing.T) {
+	data := []models.Row{
+		{
+			Name:    "cpu",
+			Columns: []string{"time", "mean"},
+			Values:  [][]interface{}{{"2018-06-14T21:47:00Z", 1.5}, {"2018-06-14T21:48:00Z", 2.5}},
+			Tags:    map[string]string{"host": "a"},
+		},
+		{
+			Name:    "cpu",
+			Columns: []string{"time", "mean"},
+			Values:  [][]interface{}{{"2018-06-14T21:47:00Z", 3.5}},
+			Tags:    map[string]string{"host": "b"},
+		},
+	}
+
+	type DecodeType struct {
+		Host string  `influx:"host,tag"`
+		Mean float64 `influx:"mean"`
+	}
+
+	grouped, err := influx.DecodeGrouped[DecodeType](data, nil)
+	if err != nil {
+		t.Fatal("Error decoding: ", err)
+	}
+
+	if len(grouped) != 2 {
+		t.Fatalf("expected 2 series, got %d", len(grouped))
+	}
+	if grouped[0].Key() != "cpu,host=a" || grouped[1].Key() != "cpu,host=b" {
+		t.Errorf("wrong series keys %s %s", grouped[0].Key(), grouped[1].Key())
+	}
+	if !reflect.DeepEqual(grouped[0].Rows, []DecodeType{{"a", 1.5}, {"a", 2.5}}) {
+		t.Errorf("decoded Value is not right %v", grouped[0].Rows)
+	}
+	if !reflect.DeepEqual(grouped[1].Rows, []DecodeType{{"b", 3.5}}) {
+		t.Errorf("decoded Value is not right %v", grouped[1].Rows)
+	}
+}
+
+func TestDecodeGroupedStrict(t *testing.T) {
+	data := []models.Row{
+		{Name: "cpu", Columns: []string{"time", "mean", "max"}, Values: [][]interface{}{{"2018-06-14T21:47:00Z", 1.5, 2}},
+			Tags: map[string]string{"host": "a,b=c"}},
+		{Name: "cpu", Columns: []string{"time", "min"}, Values: [][]interface{}{{"2018-06-14T21:47:00Z", 3.5}},
+			Tags: map[string]string{"host": "d e"}},
+	}
+
+	type DecodeType struct {
+		Host string  `influx:"host,tag"`
+		Mean float64 `influx:"mean,required"`
+	}
+
+	grouped, err := influx.DecodeGrouped[DecodeType](data, &influx.QueryOption{Strict: true})
+	var se *influx.StrictDecodeError
+	if !errors.As(err, &se) {
+		t.Fatalf("expected *StrictDecodeError, got %v", err)
+	}
+	if !reflect.DeepEqual(se.UnmappedColumns, []string{"max", "min", "time"}) || !reflect.DeepEqual(se.MissingFields, []string{"mean"}) {
+		t.Errorf("expected the merged mismatches, got %v", err)
+	}
+	if keys := []string{`cpu,host=a\,b\=c`, `cpu,host=d\ e`}; !reflect.DeepEqual(se.Series, keys) ||
+		grouped[0].Key() != keys[0] || grouped[1].Key() != keys[1] {
+		t.Errorf("expected the escaped series keys %v, got %v", keys, se.Series)
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	data := models.Row{
+		Name:    "bla",
+		Columns: []string{"val1"},
+		Values:  [][]interface{}{{1}, {"not-a-number"}},
+	}
+
+	type DecodeType struct {
+		Val1 int `influx:"val1"`
+	}
+
+	var decoded []DecodeType
+	err := influx.Decode([]models.Row{data}, &decoded)
+
+	var de *influx.DecodeError
+	if !errors.As(err, &de) {
+		t.Fatalf("expected *DecodeError, got %v", err)
+	}
+	if de.Row != 1 || de.Column != "val1" {
+		t.Errorf("wrong location row %d column %s", de.Row, de.Column)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	type MyType struct {
+		InfluxMeasurement string
+		Time              time.Time
+		Host              string `influx:",tag"`
+		Region            string `influx:",tag"`
+		Value             float64
+		Count             uint64
+		Ratio             *float64
+		Load              int
+	}
+
+	ratio := 0.5
+	p, err := influx.Encode(MyType{
+		InfluxMeasurement: "cpu", Time: time.Now(), Host: "a", Value: math.NaN(), Count: 3, Ratio: &ratio, Load: 7,
+	})
+	if err != nil {
+		t.Fatal("Error encoding: ", err)
+	}
+
+	_, err = p.Validate(influx.ValidateOption{Policy: influx.ValidateReject})
+	var ve *influx.ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("expected *ValidationError, got %v", err)
+	}
+	if len(ve.Violations) != 4 {
+		t.Fatalf("expected 4 violations, got %v", ve)
+	}
+	// the tags first, then the fields, by the sorted keys
+	var keys []string
+	for _, v := range ve.Violations {
+		keys = append(keys, v.Key)
+	}
+	if !reflect.DeepEqual(keys, []string{"region", "count", "ratio", "value"}) {
+		t.Errorf("unexpected order of violations %v", ve)
+	}
+	if v := ve.Violations[0]; v.StructField != "Region" || !v.IsTag {
+		t.Errorf("wrong violation %v", v)
+	}
+
+	dropped, err := p.Validate(influx.ValidateOption{Policy: influx.ValidateDrop})
+	if err != nil {
+		t.Fatal("Unexpected error validating: ", err)
+	}
+	if !reflect.DeepEqual(dropped.Tags, map[string]string{"host": "a"}) ||
+		!reflect.DeepEqual(dropped.Fields, map[string]interface{}{"load": 7}) {
+		t.Errorf("wrong dropped point %v", dropped)
+	}
+
+	coerced, err := p.Validate(influx.ValidateOption{Policy: influx.ValidateCoerce})
+	if err != nil {
+		t.Fatal("Unexpected error validating: ", err)
+	}
+	if !reflect.DeepEqual(coerced.Fields, map[string]interface{}{"count": int64(3), "ratio": 0.5, "load": 7}) {
+		t.Errorf("wrong coerced fields %v", coerced.Fields)
+	}
+
+	if _, ok := p.Fields["value"]; !ok {
+		t.Error("Validate must not modify the original point")
+	}
+
+	// the field colliding with the tag is renamed by coercing
+	p = influx.Point{Measurement: "cpu", Tags: map[string]string{"host": "a"}, Fields: map[string]interface{}{"host": "b", "v": 1}}
+	coerced, err = p.Validate(influx.ValidateOption{Policy: influx.ValidateCoerce})
+	if err != nil || !reflect.DeepEqual(coerced.Fields, map[string]interface{}{"host_field": "b", "v": 1}) {
+		t.Errorf("wrong coerced fields %v %v", coerced.Fields, err)
+	}
+	_, err = p.Validate(influx.ValidateOption{Policy: influx.ValidateReject})
+	if !errors.As(err, &ve) || len(ve.Violations) != 1 || ve.Violations[0].Reason != "field key collides with tag key" {
+		t.Errorf("expected the collision violation, got %v", err)
+	}
+}
+
+func TestMeasurementMeta(t *testing.T) {
+	type Cpu struct {
+		_     string `influx:",measurement:cpu,db:telegraf,rp:oneweek"`
+		Time  time.Time
+		Value float64
+	}
+
+	m := influx.MeasurementOf([]Cpu{})
+	if m != (influx.MeasurementMeta{DB: "telegraf", RetentionPolicy: "oneweek", Name: "cpu"}) {
+		t.Errorf("wrong measurement meta %v", m)
+	}
+	if q := m.Qualified(); q != `"telegraf"."oneweek"."cpu"` {
+		t.Errorf("wrong qualified name %s", q)
+	}
+	if q := (influx.MeasurementMeta{DB: "telegraf", Name: `a"b`}).Qualified(); q != `"telegraf".."a\"b"` {
+		t.Errorf("wrong qualified name %s", q)
+	}
+
+	p, err := influx.Encode(Cpu{Time: time.Now(), Value: 1})
+	if err != nil {
+		t.Fatal("Error encoding: ", err)
+	}
+	if p.Measurement != "cpu" || p.DB != "telegraf" || p.RetentionPolicy != "oneweek" {
+		t.Errorf("wrong point %v", p)
+	}
+
+	type Mem struct {
+		InfluxMeasurement string `influx:",db:telegraf"`
+		Value             float64
+	}
+	if m := influx.MeasurementOf(Mem{}); m != (influx.MeasurementMeta{DB: "telegraf", Name: "Mem"}) {
+		t.Errorf("wrong measurement meta %v", m)
+	}
+
+	// the empty InfluxMeasurement value keeps the marker name
+	type Disk struct {
+		InfluxMeasurement string `influx:",measurement:disk"`
+		Value             float64
+	}
+	if p, _ := influx.Encode(Disk{Value: 1}); p.Measurement != "disk" {
+		t.Errorf("wrong measurement %s", p.Measurement)
+	}
+	if p, _ := influx.Encode(Disk{InfluxMeasurement: "disk2", Value: 1}); p.Measurement != "disk2" {
+		t.Errorf("wrong measurement %s", p.Measurement)
+	}
+}
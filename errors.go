@@ -0,0 +1,156 @@
+package influx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bingoohuang/gg/pkg/mapstruct"
+)
+
+var (
+	// ErrDatabaseNotFound is reported when the database of a query or write does not exist.
+	ErrDatabaseNotFound = errors.New("database not found")
+	// ErrTimeout is reported when the request to the server timed out.
+	ErrTimeout = errors.New("timeout")
+)
+
+// sentinelError wraps an error, and is a sentinel error for errors.Is.
+type sentinelError struct {
+	sentinel error
+	err      error
+}
+
+func (e *sentinelError) Error() string        { return e.err.Error() }
+func (e *sentinelError) Unwrap() error        { return e.err }
+func (e *sentinelError) Is(target error) bool { return target == e.sentinel }
+
+// serverError keeps the error from the underlying client, with the message parsed from its body.
+type serverError struct {
+	msg string
+	err error
+}
+
+func (e *serverError) Error() string { return e.msg }
+func (e *serverError) Unwrap() error { return e.err }
+
+// FieldTypeConflictError is reported when a written field has a different type than the existing one.
+type FieldTypeConflictError struct {
+	Measurement  string
+	Field        string
+	Type         string
+	ExistingType string
+	Err          error
+}
+
+func (e *FieldTypeConflictError) Error() string { return e.Err.Error() }
+func (e *FieldTypeConflictError) Unwrap() error { return e.Err }
+
+// PartialWriteError is reported when the server dropped some points of a write.
+type PartialWriteError struct {
+	Dropped int
+	Err     error
+}
+
+func (e *PartialWriteError) Error() string { return e.Err.Error() }
+func (e *PartialWriteError) Unwrap() error { return e.Err }
+
+// DecodeError is reported when a query result cannot be decoded into the result data structure.
+// Row and Column locate the first failed value, Row is -1 when unknown.
+type DecodeError struct {
+	Row    int
+	Column string
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	if e.Row < 0 {
+		return fmt.Sprintf("decode column %s: %v", e.Column, e.Err)
+	}
+	return fmt.Sprintf("decode row %d column %s: %v", e.Row, e.Column, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error { return e.Err }
+
+var (
+	fieldTypeConflictRe = regexp.MustCompile(`field type conflict: input field "([^"]*)" on measurement "([^"]*)" is type (\w+), already exists as type (\w+)`)
+	droppedRe           = regexp.MustCompile(`dropped=(\d+)`)
+	decodeErrorKeyRe    = regexp.MustCompile(`'(?:\[(\d+)\]\.?)?([^']*)'`)
+)
+
+// wrapServerError wraps err returned from the underlying client into the typed errors.
+func wrapServerError(err error) error {
+	if err == nil {
+		return nil
+	}
+	// the errors of the nodes are already wrapped
+	if _, ok := err.(*MultiWriteError); ok {
+		return err
+	}
+
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return &sentinelError{sentinel: ErrTimeout, err: err}
+	}
+
+	msg := serverErrorMessage(err.Error())
+	if msg != err.Error() {
+		err = &serverError{msg: msg, err: err}
+	}
+
+	if strings.HasPrefix(msg, "database not found") {
+		return &sentinelError{sentinel: ErrDatabaseNotFound, err: err}
+	}
+
+	if subs := fieldTypeConflictRe.FindStringSubmatch(msg); len(subs) > 0 {
+		err = &FieldTypeConflictError{Field: subs[1], Measurement: subs[2], Type: subs[3], ExistingType: subs[4], Err: err}
+	}
+
+	if strings.HasPrefix(msg, "partial write") {
+		pe := &PartialWriteError{Err: err}
+		if subs := droppedRe.FindStringSubmatch(msg); len(subs) > 0 {
+			pe.Dropped, _ = strconv.Atoi(subs[1])
+		}
+		return pe
+	}
+
+	return err
+}
+
+// serverErrorMessage extracts the message from the JSON body like {"error":"..."} of a failed write,
+// or {"code":"...","message":"..."} of InfluxDB 2.x.
+func serverErrorMessage(body string) string {
+	var e struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal([]byte(body), &e); err == nil && (e.Error != "" || e.Message != "") {
+		if e.Error != "" {
+			return e.Error
+		}
+		return e.Message
+	}
+	return strings.TrimSpace(body)
+}
+
+// wrapDecodeError wraps the decoding err from mapstruct into a *DecodeError.
+func wrapDecodeError(err error) error {
+	var me *mapstruct.Error
+	if !errors.As(err, &me) || len(me.Errors) == 0 {
+		return err
+	}
+
+	de := &DecodeError{Row: -1, Err: err}
+	// mapstruct error is like: cannot parse '[1].val1' as int: ..., or '[0].val1' expected type 'int', ...
+	if subs := decodeErrorKeyRe.FindStringSubmatch(me.Errors[0]); len(subs) > 0 {
+		if subs[1] != "" {
+			de.Row, _ = strconv.Atoi(subs[1])
+		}
+		de.Column = subs[2]
+	}
+	return de
+}
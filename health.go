@@ -0,0 +1,180 @@
+package influx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Ping pings the servers in order until one responds, and returns the latency and the server version
+// from the X-Influxdb-Version header. It returns ctx.Err() when the ctx is done before the server responds.
+//
+// Like Health, it requests the addresses of WithAddr, WithAddrs or WithShards directly, which is
+// the default http://localhost:8086 with WithClient unless WithAddr is set to the server of the client.
+func (c *Cli) Ping(ctx context.Context) (time.Duration, string, error) {
+	if len(c.addrs) == 0 {
+		return 0, "", errors.New("no server address to ping")
+	}
+
+	var err error
+	for _, addr := range c.addrs {
+		req, e := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(addr, "/")+"/ping", nil)
+		if e != nil {
+			return 0, "", e
+		}
+		d, version, e := c.http.ping(req)
+		if e == nil {
+			return d, version, nil
+		}
+		if ctx.Err() != nil {
+			return 0, "", ctx.Err()
+		}
+		err = e
+	}
+	return 0, "", wrapServerError(err)
+}
+
+// Health is the health of the server reported by the /health endpoint of InfluxDB 1.8+ and 2.x.
+type Health struct {
+	Name    string `json:"name"`
+	Message string `json:"message"`
+	// Status is pass or fail.
+	Status  string `json:"status"`
+	Version string `json:"version"`
+	Commit  string `json:"commit"`
+}
+
+// Health checks the /health endpoints of all the servers, e.g. for the readiness probes.
+// It returns the health of the first unhealthy server with an error, or the one of the first server.
+// See Ping for the addresses with WithClient.
+func (c *Cli) Health(ctx context.Context) (*Health, error) {
+	var first *Health
+	for _, addr := range c.addrs {
+		h, err := c.health(ctx, addr)
+		if err != nil {
+			return h, fmt.Errorf("%s: %w", addr, err)
+		}
+		if first == nil {
+			first = h
+		}
+	}
+	return first, nil
+}
+
+func (c *Cli) health(ctx context.Context, addr string) (*Health, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(addr, "/")+"/health", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	rsp, err := c.http.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+
+	body, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if rsp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("no /health endpoint, which requires InfluxDB 1.8+")
+	}
+
+	h := &Health{}
+	if err := json.Unmarshal(body, h); err != nil {
+		return nil, fmt.Errorf("status %d: %s", rsp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if h.Status != "pass" || rsp.StatusCode != http.StatusOK {
+		return h, fmt.Errorf("unhealthy, status %s: %s", h.Status, h.Message)
+	}
+	return h, nil
+}
+
+// ServerInfo is the server version and the capabilities derived from it.
+type ServerInfo struct {
+	// Version is the server version, e.g. 1.8.10 or v2.7.1.
+	Version      string
+	Major, Minor int
+}
+
+// IsV2 tells whether the server is InfluxDB 2.x or later, which has the /api/v2/write endpoint.
+func (s ServerInfo) IsV2() bool { return s.Major >= 2 }
+
+// HasHealth tells whether the server has the /health endpoint, which is since 1.8.
+func (s ServerInfo) HasHealth() bool { return s.Major >= 2 || s.Major == 1 && s.Minor >= 8 }
+
+// ParseServerVersion parses the version like 1.8.10, v2.7.1 or 1.8.10-c1.8.10.
+func ParseServerVersion(version string) ServerInfo {
+	s := ServerInfo{Version: version}
+	parts := strings.SplitN(strings.TrimPrefix(version, "v"), ".", 3)
+	s.Major, _ = strconv.Atoi(parts[0])
+	if len(parts) > 1 {
+		s.Minor, _ = strconv.Atoi(parts[1])
+	}
+	return s
+}
+
+// ServerInfo detects the server version by ping.
+func (c *Cli) ServerInfo(ctx context.Context) (ServerInfo, error) {
+	_, version, err := c.Ping(ctx)
+	if err != nil {
+		return ServerInfo{}, err
+	}
+	return ParseServerVersion(version), nil
+}
+
+// httpDoer does the raw HTTP requests which the influxdb client does not offer, with the same settings.
+type httpDoer struct {
+	client    *http.Client
+	user      string
+	password  string
+	token     string
+	userAgent string
+}
+
+func (c *Config) httpDoer() *httpDoer {
+	d := &httpDoer{
+		client: &http.Client{Timeout: c.Timeout, Transport: c.transport()},
+		user:   c.User, password: c.Password, token: c.Token, userAgent: c.UserAgent,
+	}
+	if d.userAgent == "" {
+		d.userAgent = "InfluxDBClient"
+	}
+	return d
+}
+
+func (d *httpDoer) do(req *http.Request) (*http.Response, error) {
+	req.Header.Set("User-Agent", d.userAgent)
+	if d.token != "" {
+		req.Header.Set("Authorization", "Token "+d.token)
+	} else if d.user != "" {
+		req.SetBasicAuth(d.user, d.password)
+	}
+	return d.client.Do(req)
+}
+
+// ping sends the ping request, and returns the latency and the server version.
+func (d *httpDoer) ping(req *http.Request) (time.Duration, string, error) {
+	start := time.Now()
+	rsp, err := d.do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer rsp.Body.Close()
+
+	body, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return 0, "", err
+	}
+	if rsp.StatusCode != http.StatusNoContent {
+		return 0, "", errors.New(string(body))
+	}
+	return time.Since(start), rsp.Header.Get("X-Influxdb-Version"), nil
+}
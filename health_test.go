@@ -0,0 +1,127 @@
+package influx_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/influx"
+)
+
+func newVersionServer(version, status string, writes *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Influxdb-Version", version)
+		switch r.URL.Path {
+		case "/ping":
+			w.WriteHeader(http.StatusNoContent)
+		case "/health":
+			w.Header().Set("Content-Type", "application/json")
+			if status != "pass" {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+			_, _ = w.Write([]byte(`{"name":"influxdb","message":"ready for queries and writes","status":"` + status +
+				`","version":"` + version + `"}`))
+		default:
+			q := r.URL.Query()
+			if r.URL.Path == "/api/v2/write" && q.Get("org") == "" && q.Get("orgID") == "" {
+				// the same as InfluxDB 2.x
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"code":"invalid","message":"Please provide either orgID or org"}`))
+				return
+			}
+			*writes = append(*writes, r.URL.Path+"|"+q.Get("org")+"|"+q.Get("db")+q.Get("bucket")+"|"+
+				q.Get("precision")+"|"+r.Header.Get("Authorization"))
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+}
+
+func TestPingAndHealth(t *testing.T) {
+	var writes []string
+	ts := newVersionServer("1.8.10", "pass", &writes)
+	defer ts.Close()
+
+	c, err := influx.New(influx.WithAddr(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, version, err := c.Ping(context.Background()); err != nil || version != "1.8.10" {
+		t.Errorf("unexpected ping version %q, error %v", version, err)
+	}
+	info, err := c.ServerInfo(context.Background())
+	if err != nil || info.IsV2() || !info.HasHealth() {
+		t.Errorf("unexpected server info %+v, error %v", info, err)
+	}
+	if h, err := c.Health(context.Background()); err != nil || h.Status != "pass" || h.Version != "1.8.10" {
+		t.Errorf("unexpected health %+v, error %v", h, err)
+	}
+
+	failing := newVersionServer("1.8.10", "fail", &writes)
+	defer failing.Close()
+	c, err = influx.New(influx.WithAddrs(ts.URL, failing.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h, err := c.Health(context.Background()); err == nil || h == nil || h.Status != "fail" {
+		t.Errorf("expected unhealthy, got %+v, error %v", h, err)
+	}
+
+	// the request of the ping is canceled with the ctx
+	canceled := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		close(canceled)
+	}))
+	defer slow.Close()
+	c, _ = influx.New(influx.WithAddr(slow.URL))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, _, err := c.Ping(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Error("expected the ping request canceled")
+	}
+}
+
+func TestWriteV2(t *testing.T) {
+	var writes []string
+	v2 := newVersionServer("v2.7.1", "pass", &writes)
+	defer v2.Close()
+	v1 := newVersionServer("1.8.10", "pass", &writes)
+	defer v1.Close()
+
+	p := influx.Point{Measurement: "cpu", Fields: map[string]interface{}{"v": 1}, Time: time.Now()}
+	for _, addr := range []string{v2.URL, v1.URL} {
+		c, err := influx.New(influx.WithAddr(addr), influx.WithToken("secret"), influx.WithOrg("my-org"),
+			influx.WithPrecision("ms"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.WithDB("db").WithRP("oneweek").WritePointRaw(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := []string{"/api/v2/write|my-org|db/oneweek|ms|Token secret", "/write||db|ms|Token secret"}
+	if len(writes) != 2 || writes[0] != expected[0] || writes[1] != expected[1] {
+		t.Errorf("%v != %v", writes, expected)
+	}
+
+	// InfluxDB 2.x rejects the write without the org
+	c, err := influx.New(influx.WithAddr(v2.URL), influx.WithToken("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WritePointRaw(p); err == nil || !strings.Contains(err.Error(), "orgID or org") {
+		t.Errorf("expected the write rejected without the org, got %v", err)
+	}
+}
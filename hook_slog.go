@@ -0,0 +1,34 @@
+//go:build go1.21
+
+package influx
+
+import (
+	"context"
+	"log/slog"
+)
+
+// NewSlogHook returns a Hook which logs the calls by the logger, at the debug level, or the warn level on errors.
+func NewSlogHook(logger *slog.Logger) Hook {
+	return HookFunc(func(e Event) {
+		level := slog.LevelDebug
+		attrs := []slog.Attr{
+			slog.String("op", string(e.Op)),
+			slog.String("db", e.DB),
+			slog.Int("points", e.Points),
+			slog.Int("bytes", e.Bytes),
+			slog.Duration("duration", e.Duration),
+		}
+		if e.Query != "" {
+			attrs = append(attrs, slog.String("query", e.Query))
+		}
+		if e.RetentionPolicy != "" {
+			attrs = append(attrs, slog.String("rp", e.RetentionPolicy))
+		}
+		if e.Err != nil {
+			level = slog.LevelWarn
+			attrs = append(attrs, slog.Any("error", e.Err))
+		}
+
+		logger.LogAttrs(context.Background(), level, "influx "+string(e.Op), attrs...)
+	})
+}
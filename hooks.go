@@ -0,0 +1,87 @@
+package influx
+
+import (
+	"time"
+
+	"github.com/influxdata/influxdb1-client/models"
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+// Op is the kind of the call observed by the hooks.
+type Op string
+
+const (
+	// OpQuery is the query of DecodeQuery and DecodeQueryGrouped.
+	OpQuery Op = "query"
+	// OpWrite is the write of WritePoint, WritePointRaw and the batched WritePointsRaw.
+	OpWrite Op = "write"
+	// OpTagKeys is the show tag keys for WithTagsReturn.
+	OpTagKeys Op = "tag_keys"
+	// OpTagValues is the show tag values for WithServerTagValues.
+	OpTagValues Op = "tag_values"
+)
+
+// Event is the observation of a call to the server.
+type Event struct {
+	Op Op
+	// Query is the cleaned query text, empty for the writes.
+	Query           string
+	DB              string
+	RetentionPolicy string
+	// Points is the number of the points written, or the rows returned.
+	Points int
+	// Bytes is the size of the line protocol written, or the query text.
+	Bytes    int
+	Duration time.Duration
+	Err      error
+}
+
+// Hook observes the calls to the server, which must be safe for concurrent use.
+type Hook interface {
+	Observe(e Event)
+}
+
+// HookFunc is the func adapter of Hook.
+type HookFunc func(e Event)
+
+// Observe calls f(e).
+func (f HookFunc) Observe(e Event) { f(e) }
+
+// WithHooks adds the hooks to observe the calls, e.g. NewSlogHook(logger) or NewMetrics().
+func WithHooks(hooks ...Hook) ConfigFn {
+	return func(c *Config) { c.Hooks = append(c.Hooks, hooks...) }
+}
+
+// observe notifies the hooks of the call started at start.
+func (c *Cli) observe(e Event, start time.Time) {
+	if len(c.hooks) == 0 {
+		return
+	}
+
+	e.Duration = time.Since(start)
+	if e.Query != "" {
+		e.Bytes = len(e.Query)
+		e.Query = CleanQuery(e.Query)
+	}
+	for _, h := range c.hooks {
+		h.Observe(e)
+	}
+}
+
+func countRows(series []models.Row) (n int) {
+	for _, s := range series {
+		n += len(s.Values)
+	}
+	return n
+}
+
+// lineBytes returns the size of the line protocol of the batch, which is only computed when there are hooks.
+func (c *Cli) lineBytes(bp client.BatchPoints) (n int) {
+	if len(c.hooks) == 0 {
+		return 0
+	}
+	for _, p := range bp.Points() {
+		n += len(p.PrecisionString(bp.Precision())) + 1
+	}
+	return n
+}
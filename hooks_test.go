@@ -0,0 +1,95 @@
+//go:build go1.21
+
+package influx_test
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/influx"
+)
+
+func TestHooks(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/write" {
+			if r.URL.Query().Get("db") == "bad" {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`{"error":"database not found: \"bad\""}`))
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"results":[{"series":[{"name":"cpu","columns":["time","v"],"values":[
+			["2021-12-09T04:31:20Z",1],["2021-12-09T04:31:21Z",2]]}]}]}`))
+	}))
+	defer ts.Close()
+
+	var mu sync.Mutex
+	var events []influx.Event
+	var logs bytes.Buffer
+	metrics := influx.NewMetrics()
+	c, err := influx.New(influx.WithAddr(ts.URL), influx.WithDatabase("db"), influx.WithHooks(
+		influx.HookFunc(func(e influx.Event) {
+			mu.Lock()
+			events = append(events, e)
+			mu.Unlock()
+		}),
+		influx.NewSlogHook(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))),
+		metrics,
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var v []float64
+	if err := c.DecodeQuery("SELECT v\n  FROM cpu", &v); err != nil {
+		t.Fatal(err)
+	}
+
+	p := influx.Point{Measurement: "cpu", Fields: map[string]interface{}{"v": 1}, Time: time.Unix(1, 0)}
+	q := p
+	q.DB = "bad"
+	if err := c.WritePointsRaw([]influx.Point{p, p, q}); err == nil {
+		t.Error("expected the error of the bad database")
+	}
+
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %+v", events)
+	}
+	if e := events[0]; e.Op != influx.OpQuery || e.Query != "SELECT v FROM cpu" || e.DB != "db" || e.Points != 2 {
+		t.Errorf("unexpected query event %+v", e)
+	}
+	if e := events[1]; e.Op != influx.OpWrite || e.DB != "db" || e.Points != 2 || e.Bytes != 2*len("cpu v=1i 1000000000\n") || e.Err != nil {
+		t.Errorf("unexpected write event %+v", e)
+	}
+	if e := events[2]; e.DB != "bad" || e.Points != 1 || e.Err == nil {
+		t.Errorf("unexpected failed write event %+v", e)
+	}
+
+	if !strings.Contains(logs.String(), `level=WARN msg="influx write"`) {
+		t.Errorf("expected the warn log of the failed write, got %s", logs.String())
+	}
+
+	var exposition bytes.Buffer
+	if _, err := metrics.WriteTo(&exposition); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`influx_requests_total{op="query",db="db",status="ok"} 1`,
+		`influx_requests_total{op="write",db="bad",status="error"} 1`,
+		`influx_request_duration_seconds_count{op="write",db="db"} 1`,
+		`influx_points_total{op="write",db="db"} 2`,
+	} {
+		if !strings.Contains(exposition.String(), line) {
+			t.Errorf("expected %s in\n%s", line, exposition.String())
+		}
+	}
+}
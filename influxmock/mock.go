@@ -0,0 +1,430 @@
+// Package influxmock provides a mock of influx.Interface with the expectations on the queries and
+// the struct level writes, e.g.
+//
+//	m := influxmock.New(t)
+//	m.ExpectWritePoint(cpu{Host: "x"})
+//	m.ExpectQuery(`SELECT * FROM cpu`).Return([]cpu{{Host: "x", Usage: 1}})
+//	service := NewService(m) // accepting influx.Interface
+//
+// The unexpected calls fail the test and return errors, and the unmet expectations fail the test at its cleanup.
+package influxmock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/influx"
+	"github.com/influxdata/influxdb1-client/models"
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+// Version is the default server version reported by the Mock.
+const Version = "1.8.10"
+
+// Mock is a mock of influx.Interface.
+type Mock struct {
+	// Version is the server version reported by Ping, Health and ServerInfo.
+	Version string
+
+	*state
+	// db and rp are the defaults of the writes, set by ForDB and ForRP.
+	db, rp string
+}
+
+// state is shared by the Mock and the scoped ones of ForDB and ForRP.
+type state struct {
+	t            testing.TB
+	mu           sync.Mutex
+	expectations []*Expectation
+	writes       []Write
+}
+
+var _ influx.Interface = (*Mock)(nil)
+
+// New creates a Mock, which checks the expectations are met at the cleanup of the test.
+func New(t testing.TB) *Mock {
+	m := &Mock{Version: Version, state: &state{t: t}}
+	t.Cleanup(m.AssertExpectations)
+	return m
+}
+
+// Write is a written point with its write option.
+type Write struct {
+	Point  influx.Point
+	Option influx.WriteOption
+}
+
+// DB returns the database of the write.
+func (w Write) DB() string {
+	if w.Option.DB != "" {
+		return w.Option.DB
+	}
+	return w.Point.DB
+}
+
+// Matcher matches the writes.
+type Matcher struct {
+	desc  string
+	match func(w Write) bool
+}
+
+func (m Matcher) String() string { return m.desc }
+
+// Match creates a Matcher by the func.
+func Match(desc string, match func(w Write) bool) Matcher { return Matcher{desc: desc, match: match} }
+
+// Measurement matches the measurement of the point.
+func Measurement(name string) Matcher {
+	return Match("measurement="+name, func(w Write) bool { return w.Point.Measurement == name })
+}
+
+// DB matches the database of the write.
+func DB(name string) Matcher {
+	return Match("db="+name, func(w Write) bool { return w.DB() == name })
+}
+
+// Tag matches the tag of the point.
+func Tag(key, value string) Matcher {
+	return Match(key+"="+value, func(w Write) bool {
+		v, ok := w.Point.Tags[key]
+		return ok && v == value
+	})
+}
+
+// Field matches the field of the point, the values are compared by their formats, e.g. 1 matches int64(1).
+func Field(key string, value interface{}) Matcher {
+	return Match(fmt.Sprintf("%s=%v", key, value), func(w Write) bool {
+		v, ok := w.Point.Fields[key]
+		return ok && fmt.Sprint(v) == fmt.Sprint(value)
+	})
+}
+
+// Like matches the point of the struct by its measurement and its non-zero tags, fields and time.
+func Like(v interface{}) Matcher {
+	p, err := influx.Encode(v)
+	if err != nil {
+		return Match(fmt.Sprintf("like %+v (%v)", v, err), func(Write) bool { return false })
+	}
+
+	matchers := []Matcher{Measurement(p.Measurement)}
+	for _, k := range sortedKeys(p.Tags) {
+		if v := p.Tags[k]; v != "" {
+			matchers = append(matchers, Tag(k, v))
+		}
+	}
+	for _, k := range sortedKeys(p.Fields) {
+		if v := p.Fields[k]; v != nil && !reflect.ValueOf(v).IsZero() {
+			matchers = append(matchers, Field(k, v))
+		}
+	}
+	if !p.Time.IsZero() {
+		matchers = append(matchers, Match("time="+p.Time.String(), func(w Write) bool { return w.Point.Time.Equal(p.Time) }))
+	}
+
+	return Match(describe(matchers), func(w Write) bool { return matchAll(matchers, w) })
+}
+
+func describe(matchers []Matcher) string {
+	descs := make([]string, len(matchers))
+	for i, m := range matchers {
+		descs[i] = m.String()
+	}
+	return strings.Join(descs, " ")
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func matchAll(matchers []Matcher, w Write) bool {
+	for _, m := range matchers {
+		if !m.match(w) {
+			return false
+		}
+	}
+	return true
+}
+
+// Expectation is an expected query or write.
+type Expectation struct {
+	desc     string
+	query    string
+	write    bool
+	matchers []Matcher
+
+	result interface{}
+	rows   []models.Row
+	err    error
+	// times is the expected number of calls, -1 for any.
+	times int
+	calls int
+}
+
+// Return sets the result of the query, which is assigned to the DecodeQuery destination.
+func (e *Expectation) Return(result interface{}) *Expectation {
+	e.result = result
+	return e
+}
+
+// ReturnRows sets the series of the query, which are decoded to the DecodeQuery destination.
+func (e *Expectation) ReturnRows(rows ...models.Row) *Expectation {
+	e.rows = rows
+	return e
+}
+
+// ReturnError sets the error of the query or the write.
+func (e *Expectation) ReturnError(err error) *Expectation {
+	e.err = err
+	return e
+}
+
+// Times sets the expected number of calls, 1 by default.
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+	return e
+}
+
+// AnyTimes allows any number of calls, including none.
+func (e *Expectation) AnyTimes() *Expectation { return e.Times(-1) }
+
+func (e *Expectation) String() string { return e.desc }
+
+func (e *Expectation) met() bool { return e.times < 0 || e.calls >= e.times }
+
+func (e *Expectation) exhausted() bool { return e.times >= 0 && e.calls >= e.times }
+
+func normalize(q string) string { return strings.TrimSpace(influx.CleanQuery(q)) }
+
+// ExpectQuery expects the query, matched by the normalized text.
+func (m *Mock) ExpectQuery(q string) *Expectation {
+	return m.expect(&Expectation{desc: "query " + normalize(q), query: normalize(q)})
+}
+
+// ExpectWrite expects a written point matching all the matchers.
+func (m *Mock) ExpectWrite(matchers ...Matcher) *Expectation {
+	return m.expect(&Expectation{desc: "write " + describe(matchers), write: true, matchers: matchers})
+}
+
+// ExpectWritePoint expects a written point like the struct, see Like.
+func (m *Mock) ExpectWritePoint(v interface{}, matchers ...Matcher) *Expectation {
+	return m.ExpectWrite(append([]Matcher{Like(v)}, matchers...)...)
+}
+
+func (m *Mock) expect(e *Expectation) *Expectation {
+	e.times = 1
+	m.mu.Lock()
+	m.expectations = append(m.expectations, e)
+	m.mu.Unlock()
+	return e
+}
+
+// Writes returns all the written points.
+func (m *Mock) Writes() []Write {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Write(nil), m.writes...)
+}
+
+// AssertExpectations fails the test when any expectation is not met.
+func (m *Mock) AssertExpectations() {
+	m.t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, e := range m.expectations {
+		if !e.met() {
+			m.t.Errorf("influxmock: expected %s %d time(s), called %d time(s)", e, e.times, e.calls)
+		}
+	}
+}
+
+// find finds the first unexhausted expectation matched, or fails the test.
+func (m *Mock) find(desc string, match func(e *Expectation) bool) (*Expectation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	matched := false
+	for _, e := range m.expectations {
+		if !match(e) {
+			continue
+		}
+		matched = true
+		if !e.exhausted() {
+			e.calls++
+			return e, nil
+		}
+	}
+
+	err := fmt.Errorf("influxmock: unexpected %s", desc)
+	if matched {
+		err = fmt.Errorf("influxmock: %s called more than expected", desc)
+	}
+	m.t.Errorf("%v", err)
+	return nil, err
+}
+
+func (m *Mock) findQuery(q string) (*Expectation, error) {
+	q = normalize(q)
+	return m.find("query "+q, func(e *Expectation) bool { return !e.write && e.query == q })
+}
+
+// DecodeQuery decodes the result of the expected query to the destination.
+func (m *Mock) DecodeQuery(q string, result interface{}, options ...influx.QueryOptionFn) error {
+	m.t.Helper()
+	e, err := m.findQuery(q)
+	if err != nil {
+		return err
+	}
+	if e.err != nil {
+		return e.err
+	}
+
+	if e.result != nil {
+		return assign(result, e.result)
+	}
+
+	option := &influx.QueryOption{}
+	for _, f := range options {
+		f(option)
+	}
+	return influx.DecodeOption(e.rows, result, option)
+}
+
+// assign assigns the value, or the one it points to, to the destination pointer.
+func assign(dst, v interface{}) error {
+	dv := reflect.ValueOf(dst)
+	if dv.Kind() != reflect.Ptr || dv.IsNil() {
+		return errors.New("result must be a non-nil pointer")
+	}
+
+	vv := reflect.ValueOf(v)
+	if !vv.Type().AssignableTo(dv.Elem().Type()) && vv.Kind() == reflect.Ptr {
+		vv = vv.Elem()
+	}
+	if !vv.Type().AssignableTo(dv.Elem().Type()) {
+		return fmt.Errorf("influxmock: the result of type %s is not assignable to %s", vv.Type(), dv.Elem().Type())
+	}
+
+	dv.Elem().Set(vv)
+	return nil
+}
+
+// Query returns the series of the expected query.
+func (m *Mock) Query(q client.Query) (*client.Response, error) {
+	m.t.Helper()
+	e, err := m.findQuery(q.Command)
+	if err != nil {
+		return nil, err
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+	return &client.Response{Results: []client.Result{{Series: e.rows}}}, nil
+}
+
+// QueryChunked calls fn with the series of the expected query in one chunk.
+func (m *Mock) QueryChunked(q string, _ int, fn func(series []models.Row) error, _ ...influx.QueryOptionFn) error {
+	m.t.Helper()
+	e, err := m.findQuery(q)
+	if err != nil {
+		return err
+	}
+	if e.err != nil {
+		return e.err
+	}
+	return fn(e.rows)
+}
+
+// WritePoint encodes the struct and writes it like WritePointRaw.
+func (m *Mock) WritePoint(data interface{}, options ...influx.WriteOptionFn) error {
+	m.t.Helper()
+	p, err := influx.Encode(data)
+	if err != nil {
+		return err
+	}
+	return m.WritePointRaw(p, options...)
+}
+
+// WritePointRaw records the point, which should match an expected write.
+func (m *Mock) WritePointRaw(p influx.Point, options ...influx.WriteOptionFn) error {
+	m.t.Helper()
+	option := influx.WriteOption{}
+	for _, f := range options {
+		f(&option)
+	}
+	// the same precedence as the Cli: the option, the point, and then the scope
+	if option.DB == "" && p.DB == "" {
+		option.DB = m.db
+	}
+	if option.RetentionPolicy == "" && p.RetentionPolicy == "" {
+		option.RetentionPolicy = m.rp
+	}
+
+	w := Write{Point: p, Option: option}
+	m.mu.Lock()
+	m.writes = append(m.writes, w)
+	m.mu.Unlock()
+
+	desc := fmt.Sprintf("write %s tags %v fields %v", p.Measurement, p.Tags, p.Fields)
+	e, err := m.find(desc, func(e *Expectation) bool { return e.write && matchAll(e.matchers, w) })
+	if err != nil {
+		return err
+	}
+	return e.err
+}
+
+// WritePointsRaw writes the points one by one like WritePointRaw.
+func (m *Mock) WritePointsRaw(points []influx.Point, options ...influx.WriteOptionFn) error {
+	m.t.Helper()
+	for _, p := range points {
+		if err := m.WritePointRaw(p, options...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Ping returns the Version.
+func (m *Mock) Ping(context.Context) (time.Duration, string, error) { return 0, m.Version, nil }
+
+// Health returns the passed health.
+func (m *Mock) Health(context.Context) (*influx.Health, error) {
+	return &influx.Health{Name: "influxdb", Message: "ready for queries and writes", Status: "pass", Version: m.Version}, nil
+}
+
+// ServerInfo returns the server info of the Version.
+func (m *Mock) ServerInfo(context.Context) (influx.ServerInfo, error) {
+	return influx.ParseServerVersion(m.Version), nil
+}
+
+// ForDB returns the Mock which writes to the database by default, sharing the expectations and the writes.
+func (m *Mock) ForDB(db string) influx.Interface {
+	mm := *m
+	mm.db = db
+	return &mm
+}
+
+// ForRP returns the Mock which writes to the retention policy by default, sharing the expectations and the writes.
+func (m *Mock) ForRP(rp string) influx.Interface {
+	mm := *m
+	mm.rp = rp
+	return &mm
+}
+
+// InvalidateTagKeys does nothing.
+func (m *Mock) InvalidateTagKeys(string, string) {}
+
+// Close does nothing.
+func (m *Mock) Close() error { return nil }
@@ -0,0 +1,141 @@
+package influxmock_test
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/influx"
+	"github.com/bingoohuang/influx/influxmock"
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+type cpu struct {
+	_     string `influx:",measurement:cpu"`
+	Time  time.Time
+	Host  string `influx:",tag"`
+	Usage float64
+}
+
+// service is a consumer of the influx.Interface.
+type service struct{ db influx.Interface }
+
+func (s service) record(host string, usage float64) error {
+	return s.db.WritePoint(cpu{Time: time.Now(), Host: host, Usage: usage}, influx.WithWriteDB("metrics"))
+}
+
+func (s service) usages() ([]cpu, error) {
+	var rows []cpu
+	err := s.db.DecodeQuery(`SELECT * FROM cpu`, &rows)
+	return rows, err
+}
+
+// byHost groups the usages by host in the database.
+func (s service) byHost(db string) ([]influx.Series[cpu], error) {
+	return influx.DecodeQueryGrouped[cpu](s.db.ForDB(db), `SELECT * FROM cpu GROUP BY host`)
+}
+
+func (s service) recordTo(db, rp string, host string) error {
+	return s.db.ForDB(db).ForRP(rp).WritePoint(cpu{Time: time.Now(), Host: host})
+}
+
+// fakeT records the failures of the mock.
+type fakeT struct {
+	testing.TB
+	errors   []string
+	cleanups []func()
+}
+
+func (t *fakeT) Helper()          {}
+func (t *fakeT) Cleanup(f func()) { t.cleanups = append(t.cleanups, f) }
+func (t *fakeT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestMock(t *testing.T) {
+	m := influxmock.New(t)
+	m.ExpectWritePoint(cpu{Host: "x"}, influxmock.DB("metrics"))
+	m.ExpectWrite(influxmock.Measurement("cpu"), influxmock.Tag("host", "y"), influxmock.Field("usage", 2)).
+		ReturnError(influx.ErrDatabaseNotFound)
+	m.ExpectQuery("SELECT *\n FROM cpu").Return([]cpu{{Host: "x", Usage: 1}})
+	m.ExpectQuery(`SELECT * FROM cpu`).ReturnRows(models.Row{
+		Name: "cpu", Columns: []string{"time", "host", "usage"}, Values: [][]interface{}{{"2021-12-09T04:30:00Z", "z", 3.0}},
+	})
+
+	s := service{db: m}
+	if err := s.record("x", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.record("y", 2); !errors.Is(err, influx.ErrDatabaseNotFound) {
+		t.Errorf("expected the returned error, got %v", err)
+	}
+	if writes := m.Writes(); len(writes) != 2 || writes[0].DB() != "metrics" || writes[1].Point.Tags["host"] != "y" {
+		t.Errorf("unexpected writes %+v", writes)
+	}
+
+	rows, err := s.usages()
+	if err != nil || !reflect.DeepEqual(rows, []cpu{{Host: "x", Usage: 1}}) {
+		t.Errorf("unexpected %v %+v", err, rows)
+	}
+	rows, err = s.usages()
+	if err != nil || len(rows) != 1 || rows[0].Host != "z" || rows[0].Usage != 3 {
+		t.Errorf("unexpected %v %+v", err, rows)
+	}
+}
+
+func TestMockFailures(t *testing.T) {
+	ft := &fakeT{}
+	m := influxmock.New(ft)
+	m.ExpectWritePoint(cpu{Host: "x"})
+	m.ExpectQuery(`SHOW DATABASES`).AnyTimes()
+	m.ExpectQuery(`SELECT * FROM cpu`).Times(2)
+
+	s := service{db: m}
+	if err := s.record("y", 1); err == nil {
+		t.Error("expected the unexpected write error")
+	}
+	if _, err := s.usages(); err != nil {
+		t.Error(err)
+	}
+
+	for _, f := range ft.cleanups {
+		f()
+	}
+	expected := []string{
+		"influxmock: unexpected write cpu tags map[host:y] fields map[usage:1]",
+		"influxmock: expected write measurement=cpu host=x 1 time(s), called 0 time(s)",
+		"influxmock: expected query SELECT * FROM cpu 2 time(s), called 1 time(s)",
+	}
+	if !reflect.DeepEqual(ft.errors, expected) {
+		t.Errorf("unexpected failures %q", ft.errors)
+	}
+}
+
+func TestMockScoped(t *testing.T) {
+	m := influxmock.New(t)
+	m.ExpectWritePoint(cpu{Host: "x"}, influxmock.DB("metrics"))
+	m.ExpectQuery(`SELECT * FROM cpu GROUP BY host`).ReturnRows(
+		models.Row{Name: "cpu", Tags: map[string]string{"host": "x"}, Columns: []string{"time", "usage"},
+			Values: [][]interface{}{{"2021-12-09T04:30:00Z", 1.0}}},
+		models.Row{Name: "cpu", Tags: map[string]string{"host": "y"}, Columns: []string{"time", "usage"},
+			Values: [][]interface{}{{"2021-12-09T04:30:00Z", 2.0}, {"2021-12-09T04:31:00Z", 3.0}}},
+	)
+
+	s := service{db: m}
+	if err := s.recordTo("metrics", "oneweek", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if w := m.Writes(); len(w) != 1 || w[0].DB() != "metrics" || w[0].Option.RetentionPolicy != "oneweek" {
+		t.Errorf("expected the write scoped to metrics.oneweek, got %+v", w)
+	}
+
+	grouped, err := s.byHost("metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(grouped) != 2 || grouped[1].Tags["host"] != "y" || len(grouped[1].Rows) != 2 || grouped[1].Rows[1].Usage != 3 {
+		t.Errorf("unexpected series %+v", grouped)
+	}
+}
@@ -0,0 +1,324 @@
+package influx
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bingoohuang/influx/internal/influxql"
+)
+
+// Source is a measurement source in the FROM clause of an InfluxQL statement.
+type Source struct {
+	DB              string
+	RetentionPolicy string
+	// Name is the measurement name, or the regex pattern without the slashes when Regex is true.
+	Name  string
+	Regex bool
+}
+
+// Match tells whether the source matches the measurement name.
+func (s Source) Match(measurement string) bool {
+	if !s.Regex {
+		return s.Name == measurement
+	}
+	re, err := regexp.Compile(s.Name)
+	return err == nil && re.MatchString(measurement)
+}
+
+// ParseSources extracts the measurement sources from the FROM clauses of the InfluxQL query,
+// including the ones of subqueries, e.g.
+//
+//	SELECT mean(v) FROM (SELECT * FROM "db"."rp"."cpu.load"), /mem.*/ WHERE ...
+//
+// yields db.rp.cpu.load and the regex mem.*. The keywords are case-insensitive.
+func ParseSources(query string) ([]Source, error) {
+	p := &qlParser{Scanner: influxql.Scanner{Query: query}}
+	if err := p.statement(0); err != nil {
+		return nil, err
+	}
+	return p.sources, nil
+}
+
+// TimeCondition extracts the time predicates of the top level WHERE clause of the InfluxQL query,
+// e.g. `time > now() - 1h AND time < now()` from
+//
+//	SELECT * FROM cpu WHERE host = 'a' AND time > now() - 1h AND time < now() GROUP BY host
+//
+// It returns empty when there is no such predicate, or the WHERE clause has an OR at the top level
+// which makes the time range not extractable.
+func TimeCondition(query string) string {
+	p := &qlParser{Scanner: influxql.Scanner{Query: query}}
+	depth := 0
+	for {
+		t, err := p.Next()
+		if err != nil || t.Kind == influxql.EOF || t.IsPunct(";") {
+			return ""
+		}
+		switch {
+		case t.IsPunct("("):
+			depth++
+		case t.IsPunct(")"):
+			depth--
+		case depth == 0 && t.IsKeyword("where"):
+			return p.timeCondition()
+		}
+	}
+}
+
+var whereEndKeywords = []string{"group", "order", "limit", "offset", "slimit", "soffset", "fill", "tz", "into"}
+
+// timeCondition collects the time predicates of the conjuncts in the WHERE clause.
+func (p *qlParser) timeCondition() string {
+	var predicates []string
+	depth, start := 0, p.Pos
+	isTime, first := false, true
+
+	endConjunct := func(end int) {
+		if isTime {
+			predicates = append(predicates, strings.TrimSpace(p.Query[start:end]))
+		}
+		start, isTime, first = end, false, true
+	}
+
+	for {
+		t, err := p.Next()
+		if err != nil {
+			return ""
+		}
+
+		if depth == 0 && (t.Kind == influxql.EOF || t.IsPunct(";") || t.IsPunct(")") || isOneOfKeywords(t, whereEndKeywords)) {
+			endConjunct(t.Pos)
+			break
+		}
+
+		switch {
+		case t.IsPunct("("):
+			depth++
+		case t.IsPunct(")"):
+			depth--
+		case depth == 0 && t.IsKeyword("or"):
+			return ""
+		case depth == 0 && t.IsKeyword("and"):
+			endConjunct(t.Pos)
+			start = p.Pos
+			continue
+		case first:
+			isTime = (t.Kind == influxql.Ident || t.Kind == influxql.QuotedIdent) && strings.EqualFold(t.Text, "time")
+		}
+		first = false
+	}
+
+	return strings.Join(predicates, " AND ")
+}
+
+// BucketNow replaces the now() calls in the InfluxQL query with the time literal of now truncated to
+// the bucket, e.g. time > now() - 5m becomes time > '2021-12-09T04:30:00Z' - 5m with a 1m bucket,
+// so that the query text stays the same within the bucket.
+func BucketNow(query string, now time.Time, bucket time.Duration) string {
+	literal := "'" + now.Truncate(bucket).UTC().Format(time.RFC3339Nano) + "'"
+
+	var b strings.Builder
+	p := &qlParser{Scanner: influxql.Scanner{Query: query}}
+	last, replaced := 0, false
+	for {
+		t, err := p.Next()
+		if err != nil || t.Kind == influxql.EOF {
+			break
+		}
+		if !t.IsKeyword("now") {
+			continue
+		}
+
+		end := p.Pos
+		if open, err := p.Next(); err != nil || !open.IsPunct("(") {
+			p.Reset(end)
+			continue
+		}
+		if closing, err := p.Next(); err != nil || !closing.IsPunct(")") {
+			p.Reset(end)
+			continue
+		}
+
+		b.WriteString(query[last:t.Pos])
+		b.WriteString(literal)
+		last, replaced = p.Pos, true
+	}
+
+	if !replaced {
+		return query
+	}
+
+	b.WriteString(query[last:])
+	return b.String()
+}
+
+// statementClauses are the clauses of the top level of a statement, which limit or order the result rows.
+type statementClauses struct {
+	desc                           bool
+	limit, offset, slimit, soffset int
+}
+
+// parseStatementClauses parses the ORDER BY time, LIMIT, OFFSET, SLIMIT and SOFFSET clauses of each statement
+// of the InfluxQL query, the ones of the subqueries, comments, string literals and identifiers are skipped.
+func parseStatementClauses(query string) ([]statementClauses, error) {
+	p := &qlParser{Scanner: influxql.Scanner{Query: query}}
+	var clauses []statementClauses
+	var c statementClauses
+	depth, empty := 0, true
+	for {
+		t, err := p.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		if depth == 0 && (t.Kind == influxql.EOF || t.IsPunct(";")) {
+			if !empty {
+				clauses = append(clauses, c)
+			}
+			if t.Kind == influxql.EOF {
+				return clauses, nil
+			}
+			c, empty = statementClauses{}, true
+			continue
+		}
+		empty = false
+
+		switch {
+		case t.IsPunct("("):
+			depth++
+		case t.IsPunct(")"):
+			depth--
+		case depth > 0:
+		case t.IsKeyword("order"):
+			c.desc, err = p.orderByTime()
+		case t.IsKeyword("limit"):
+			c.limit, err = p.number(t)
+		case t.IsKeyword("offset"):
+			c.offset, err = p.number(t)
+		case t.IsKeyword("slimit"):
+			c.slimit, err = p.number(t)
+		case t.IsKeyword("soffset"):
+			c.soffset, err = p.number(t)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// orderByTime parses BY time [ASC | DESC] after ORDER, and tells whether it is descending.
+func (p *qlParser) orderByTime() (bool, error) {
+	if t, err := p.Next(); err != nil || !t.IsKeyword("by") {
+		return false, fmt.Errorf("expected BY after ORDER in %q", p.Query)
+	}
+	if t, err := p.Next(); err != nil || !t.IsName() || !strings.EqualFold(t.Text, "time") {
+		return false, fmt.Errorf("only ORDER BY time is supported in %q", p.Query)
+	}
+	t, err := p.Peek()
+	if err != nil {
+		return false, err
+	}
+	if t.IsKeyword("asc") || t.IsKeyword("desc") {
+		p.Skip()
+	}
+	return t.IsKeyword("desc"), nil
+}
+
+// number parses the non-negative integer after the keyword.
+func (p *qlParser) number(keyword influxql.Token) (int, error) {
+	t, err := p.Next()
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(t.Text)
+	if t.Kind != influxql.Number || err != nil || n < 0 {
+		return 0, fmt.Errorf("expected integer after %s at %d in %q", strings.ToUpper(keyword.Text), t.Pos, p.Query)
+	}
+	return n, nil
+}
+
+func isOneOfKeywords(t influxql.Token, keywords []string) bool {
+	for _, kw := range keywords {
+		if t.IsKeyword(kw) {
+			return true
+		}
+	}
+	return false
+}
+
+// qlParser is a minimal InfluxQL scanner which understands just enough to find the FROM clauses.
+type qlParser struct {
+	influxql.Scanner
+	sources []Source
+}
+
+// statement scans the tokens until the end of the query, or the closing parenthesis when depth > 0.
+func (p *qlParser) statement(depth int) error {
+	for {
+		t, err := p.Next()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case t.Kind == influxql.EOF:
+			if depth > 0 {
+				return fmt.Errorf("unclosed parenthesis in %q", p.Query)
+			}
+			return nil
+		case t.IsPunct("("):
+			if err := p.statement(depth + 1); err != nil {
+				return err
+			}
+		case t.IsPunct(")"):
+			if depth == 0 {
+				return fmt.Errorf("unexpected ) at %d in %q", t.Pos, p.Query)
+			}
+			return nil
+		case t.IsKeyword("from"):
+			if err := p.sourceList(depth); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// sourceList parses the comma separated sources after FROM.
+func (p *qlParser) sourceList(depth int) error {
+	for {
+		t, err := p.Peek()
+		if err != nil {
+			return err
+		}
+
+		if t.IsPunct("(") {
+			p.Skip()
+			if err := p.statement(depth + 1); err != nil {
+				return err
+			}
+		} else if err := p.source(); err != nil {
+			return err
+		}
+
+		if t, err = p.Peek(); err != nil {
+			return err
+		}
+		if !t.IsPunct(",") {
+			return nil
+		}
+		p.Skip()
+	}
+}
+
+// source parses a measurement like m, rp.m, db.rp.m, db..m or /regex/ in place of m.
+func (p *qlParser) source() error {
+	s, err := p.Scanner.Source()
+	if err != nil {
+		return fmt.Errorf("%w in %q", err, p.Query)
+	}
+	p.sources = append(p.sources, Source(s))
+	return nil
+}
@@ -0,0 +1,92 @@
+package influx_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/influx"
+)
+
+func TestParseSources(t *testing.T) {
+	data := []struct {
+		query   string
+		sources []influx.Source
+	}{
+		{`select * from cpu`, []influx.Source{{Name: "cpu"}}},
+		{`SELECT * FROM metrics.autogen.QPS_dsvsServer ORDER BY time DESC LIMIT 100`,
+			[]influx.Source{{DB: "metrics", RetentionPolicy: "autogen", Name: "QPS_dsvsServer"}}},
+		{`SELECT * FROM oneweek.cpu`, []influx.Source{{RetentionPolicy: "oneweek", Name: "cpu"}}},
+		{`select * from telegraf..cpu`, []influx.Source{{DB: "telegraf", Name: "cpu"}}},
+		{`select "a.b" from "my.db"."rp"."cpu.load" where "host" = 'from x'`,
+			[]influx.Source{{DB: "my.db", RetentionPolicy: "rp", Name: "cpu.load"}}},
+		{`select * from /cpu.*/, mem where time > now() - 5m`,
+			[]influx.Source{{Name: "cpu.*", Regex: true}, {Name: "mem"}}},
+		{`select * from db.rp./^cpu\/x/`, []influx.Source{{DB: "db", RetentionPolicy: "rp", Name: "^cpu/x", Regex: true}}},
+		{`SELECT max(m) FROM (SELECT mean(usage) AS m FROM telegraf.autogen.cpu GROUP BY host), disk`,
+			[]influx.Source{{DB: "telegraf", RetentionPolicy: "autogen", Name: "cpu"}, {Name: "disk"}}},
+		{`select value/2 from cpu; select * from mem`, []influx.Source{{Name: "cpu"}, {Name: "mem"}}},
+		{`SELECT * FROM cpu WHERE host =~ /from.*/ AND region !~ /it's "from"/`, []influx.Source{{Name: "cpu"}}},
+		{`SELECT * FROM db..cpu WHERE host = 'from /x/' AND path = 'it\'s from'`, []influx.Source{{DB: "db", Name: "cpu"}}},
+	}
+
+	for _, d := range data {
+		sources, err := influx.ParseSources(d.query)
+		if err != nil {
+			t.Errorf("parse %s: %v", d.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(sources, d.sources) {
+			t.Errorf("parse %s: %v != %v", d.query, sources, d.sources)
+		}
+	}
+
+	for _, q := range []string{`select * from (select * from cpu`, `select * from "cpu`, `select * from /cpu`} {
+		if _, err := influx.ParseSources(q); err == nil {
+			t.Errorf("expected error parsing %s", q)
+		}
+	}
+
+	if s := (influx.Source{Name: "^cpu", Regex: true}); !s.Match("cpu0") || s.Match("mem") {
+		t.Error("regex source does not match correctly")
+	}
+}
+
+func TestTimeCondition(t *testing.T) {
+	data := []struct {
+		query     string
+		condition string
+	}{
+		{`select * from cpu`, ``},
+		{`SELECT * FROM cpu WHERE time > now() - 5m ORDER BY time DESC LIMIT 1`, `time > now() - 5m`},
+		{`select * from cpu where host = 'a' and time >= '2021-12-09T00:00:00Z' AND "time" < now() group by host`,
+			`time >= '2021-12-09T00:00:00Z' AND "time" < now()`},
+		{`select * from cpu where host =~ /a(nd|or)/ and time > now() - 1h`, `time > now() - 1h`},
+		{`select * from cpu where host !~ /'group by/ and time > now() - 1h`, `time > now() - 1h`},
+		{`select * from cpu where host = 'a' or time > now() - 1h`, ``},
+		{`select * from (select * from cpu where time > now() - 1h) where v > 1`, ``},
+		{`select * from cpu where (host = 'a' or host = 'b') and time > now() - 1h`, `time > now() - 1h`},
+	}
+
+	for _, d := range data {
+		if c := influx.TimeCondition(d.query); c != d.condition {
+			t.Errorf("time condition of %s: %q != %q", d.query, c, d.condition)
+		}
+	}
+}
+
+func TestBucketNow(t *testing.T) {
+	now := time.Date(2021, 12, 9, 4, 31, 22, 0, time.UTC)
+	q := influx.BucketNow(`select * from cpu where time > now() - 5m and host = 'now()' and time < NOW ( )`, now, time.Minute)
+	expected := `select * from cpu where time > '2021-12-09T04:31:00Z' - 5m and host = 'now()' and time < '2021-12-09T04:31:00Z'`
+	if q != expected {
+		t.Errorf("%s != %s", q, expected)
+	}
+
+	if q := influx.BucketNow(`select now from cpu`, now, time.Minute); q != `select now from cpu` {
+		t.Errorf("unexpected replacement %s", q)
+	}
+	if q := influx.BucketNow(`select * from cpu where host =~ /now()/`, now, time.Minute); q != `select * from cpu where host =~ /now()/` {
+		t.Errorf("unexpected replacement in regex %s", q)
+	}
+}
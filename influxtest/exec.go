@@ -0,0 +1,618 @@
+package influxtest
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+// executor executes the statements of a query with the server locked.
+type executor struct {
+	s     *Server
+	db    string
+	rp    string
+	epoch string
+}
+
+func (e *executor) execute(stmt interface{}) ([]models.Row, error) {
+	switch st := stmt.(type) {
+	case createDatabase:
+		e.s.createDatabase(st.name)
+		return nil, nil
+	case dropDatabase:
+		delete(e.s.dbs, st.name)
+		return nil, nil
+	case showDatabases:
+		row := models.Row{Name: "databases", Columns: []string{"name"}}
+		for _, name := range sortedKeys(e.s.dbs) {
+			row.Values = append(row.Values, []interface{}{name})
+		}
+		return []models.Row{row}, nil
+	case dropMeasurement:
+		d, err := e.database("")
+		if err == nil {
+			for _, r := range d.rps {
+				delete(r.measurements, st.name)
+			}
+		}
+		return nil, err
+	case showMeasurements:
+		d, err := e.database(st.db)
+		if err != nil {
+			return nil, err
+		}
+		// the measurements of all the retention policies
+		names := make(map[string]bool)
+		for _, r := range d.rps {
+			for name := range r.measurements {
+				names[name] = true
+			}
+		}
+		row := models.Row{Name: "measurements", Columns: []string{"name"}}
+		for _, name := range sortedKeys(names) {
+			row.Values = append(row.Values, []interface{}{name})
+		}
+		return nonEmpty(row), nil
+	case showTagKeys:
+		return e.showTagKeys(st)
+	case showTagValues:
+		return e.showTagValues(st)
+	case showFieldKeys:
+		return e.showFieldKeys(st)
+	case *selectStatement:
+		return e.selectRows(st)
+	}
+	return nil, fmt.Errorf("unsupported statement %T", stmt)
+}
+
+// database returns the database of the name, or of the query when empty.
+func (e *executor) database(name string) (*database, error) {
+	if name == "" {
+		name = e.db
+	}
+	if name == "" {
+		return nil, errors.New("database name required")
+	}
+	d, ok := e.s.dbs[name]
+	if !ok {
+		return nil, fmt.Errorf("database not found: %s", name)
+	}
+	return d, nil
+}
+
+// sourcesRP returns the retention policy of the sources, which is the qualified one or the one of the query,
+// in the qualified database or the one of the query.
+func (e *executor) sourcesRP(db string, sources []source) (*retentionPolicy, error) {
+	rp := e.rp
+	for _, src := range sources {
+		if src.db != "" {
+			db = src.db
+		}
+		if src.rp != "" {
+			rp = src.rp
+		}
+	}
+	if db == "" {
+		db = e.db
+	}
+	if db == "" {
+		return nil, errors.New("database name required")
+	}
+	if _, ok := e.s.dbs[db]; !ok {
+		return nil, fmt.Errorf("database not found: %s", db)
+	}
+	return e.s.retentionPolicy(db, rp)
+}
+
+func nonEmpty(row models.Row) []models.Row {
+	if len(row.Values) == 0 {
+		return nil
+	}
+	return []models.Row{row}
+}
+
+func (e *executor) showTagKeys(st showTagKeys) ([]models.Row, error) {
+	rp, err := e.sourcesRP(st.db, st.sources)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.Row
+	for _, name := range rp.measurementsOf(st.sources) {
+		row := models.Row{Name: name, Columns: []string{"tagKey"}}
+		for _, k := range rp.measurements[name].tagKeys() {
+			row.Values = append(row.Values, []interface{}{k})
+		}
+		rows = append(rows, nonEmpty(row)...)
+	}
+	return rows, nil
+}
+
+func (e *executor) showFieldKeys(st showFieldKeys) ([]models.Row, error) {
+	rp, err := e.sourcesRP(st.db, st.sources)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.Row
+	for _, name := range rp.measurementsOf(st.sources) {
+		m := rp.measurements[name]
+		row := models.Row{Name: name, Columns: []string{"fieldKey", "fieldType"}}
+		for _, k := range sortedKeys(m.fieldTypes) {
+			row.Values = append(row.Values, []interface{}{k, m.fieldTypes[k]})
+		}
+		rows = append(rows, nonEmpty(row)...)
+	}
+	return rows, nil
+}
+
+func (e *executor) showTagValues(st showTagValues) ([]models.Row, error) {
+	rp, err := e.sourcesRP(st.db, st.sources)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.Row
+	for _, name := range rp.measurementsOf(st.sources) {
+		values := make(map[string]map[string]bool)
+		for _, r := range rp.measurements[name].rows(st.cond) {
+			for _, k := range st.keys {
+				if v, ok := r.tags[k]; ok {
+					if values[k] == nil {
+						values[k] = make(map[string]bool)
+					}
+					values[k][v] = true
+				}
+			}
+		}
+
+		row := models.Row{Name: name, Columns: []string{"key", "value"}}
+		for _, k := range sortedKeys(values) {
+			for _, v := range sortedKeys(values[k]) {
+				row.Values = append(row.Values, []interface{}{k, v})
+			}
+		}
+		rows = append(rows, nonEmpty(row)...)
+	}
+	return rows, nil
+}
+
+// row is a point of a series.
+type row struct {
+	time   int64
+	key    string
+	tags   map[string]string
+	fields map[string]interface{}
+}
+
+// rows returns the points matching the condition, ordered by time and series.
+func (m *measurement) rows(cond expr) []row {
+	var rows []row
+	for _, sr := range m.series {
+		for t, fields := range sr.points {
+			r := row{time: t, key: sr.key, tags: sr.tags, fields: fields}
+			if cond == nil || isTrue(eval(cond, r)) {
+				rows = append(rows, r)
+			}
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].time != rows[j].time {
+			return rows[i].time < rows[j].time
+		}
+		return rows[i].key < rows[j].key
+	})
+	return rows
+}
+
+func (e *executor) selectRows(st *selectStatement) ([]models.Row, error) {
+	rp, err := e.sourcesRP("", st.sources)
+	if err != nil {
+		return nil, err
+	}
+
+	aggregated := 0
+	for _, f := range st.fields {
+		if f.call != "" {
+			aggregated++
+		}
+	}
+	if aggregated > 0 && aggregated < len(st.fields) {
+		return nil, errors.New("mixing aggregate and non-aggregate queries is not supported")
+	}
+	if aggregated == 0 && st.groupByTime > 0 {
+		return nil, errors.New("GROUP BY requires at least one aggregate function")
+	}
+
+	var result []models.Row
+	for _, name := range rp.measurementsOf(st.sources) {
+		m := rp.measurements[name]
+
+		dims := st.groupByTags
+		if st.groupByAll {
+			dims = m.tagKeys()
+		}
+
+		groups := make(map[string][]row)
+		for _, r := range m.rows(st.cond) {
+			k := joinTags(r.tags, dims)
+			groups[k] = append(groups[k], r)
+		}
+
+		for _, k := range sortedKeys(groups) {
+			rows := groups[k]
+			series := models.Row{Name: name}
+			if len(dims) > 0 {
+				series.Tags = make(map[string]string)
+				for _, dim := range dims {
+					series.Tags[dim] = rows[0].tags[dim]
+				}
+			}
+
+			if aggregated > 0 {
+				series.Columns, series.Values = e.aggregate(st, rows)
+			} else {
+				series.Columns, series.Values = e.raw(st, m, dims, rows)
+			}
+
+			if st.desc {
+				for i, j := 0, len(series.Values)-1; i < j; i, j = i+1, j-1 {
+					series.Values[i], series.Values[j] = series.Values[j], series.Values[i]
+				}
+			}
+			series.Values = page(series.Values, st.offset, st.limit)
+			if len(series.Values) > 0 {
+				result = append(result, series)
+			}
+		}
+	}
+	return result, nil
+}
+
+func page(values [][]interface{}, offset, limit int) [][]interface{} {
+	if offset >= len(values) {
+		return nil
+	}
+	values = values[offset:]
+	if limit > 0 && limit < len(values) {
+		values = values[:limit]
+	}
+	return values
+}
+
+// raw selects the fields and tags of the rows, skipping the ones without any selected field.
+func (e *executor) raw(st *selectStatement, m *measurement, dims []string, rows []row) ([]string, [][]interface{}) {
+	columns := []string{"time"}
+	var names []string
+	for _, f := range st.fields {
+		if f.name != "*" {
+			columns = append(columns, f.column())
+			names = append(names, f.name)
+			continue
+		}
+
+		all := make(map[string]bool)
+		for k := range m.fieldTypes {
+			all[k] = true
+		}
+		for _, k := range m.tagKeys() {
+			all[k] = true
+		}
+		for _, k := range dims {
+			delete(all, k)
+		}
+		for _, k := range sortedKeys(all) {
+			columns = append(columns, k)
+			names = append(names, k)
+		}
+	}
+
+	var values [][]interface{}
+	for _, r := range rows {
+		value := []interface{}{e.formatTime(r.time)}
+		hasField := false
+		for _, name := range names {
+			if v, ok := r.fields[name]; ok {
+				value = append(value, v)
+				hasField = true
+			} else if v, ok := r.tags[name]; ok {
+				value = append(value, v)
+			} else {
+				value = append(value, nil)
+			}
+		}
+		if hasField {
+			values = append(values, value)
+		}
+	}
+	return columns, values
+}
+
+// aggregate computes the aggregates of the rows per GROUP BY time bucket, the empty buckets are skipped.
+func (e *executor) aggregate(st *selectStatement, rows []row) ([]string, [][]interface{}) {
+	columns := []string{"time"}
+	for _, f := range st.fields {
+		columns = append(columns, f.column())
+	}
+
+	var buckets []int64
+	bucketRows := make(map[int64][]row)
+	for _, r := range rows {
+		b := int64(0)
+		if st.groupByTime > 0 {
+			b = r.time - mod(r.time, int64(st.groupByTime))
+		}
+		if _, ok := bucketRows[b]; !ok {
+			buckets = append(buckets, b)
+		}
+		bucketRows[b] = append(bucketRows[b], r)
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i] < buckets[j] })
+
+	// a sole selector without GROUP BY time returns the time of the selected point
+	selectorTime := st.groupByTime == 0 && len(st.fields) == 1 && st.fields[0].call != "count" &&
+		st.fields[0].call != "sum" && st.fields[0].call != "mean"
+
+	var values [][]interface{}
+	for _, b := range buckets {
+		value := []interface{}{nil}
+		t, hasValue := b, false
+		for _, f := range st.fields {
+			v, vt := aggregate(f.call, f.name, bucketRows[b])
+			if v != nil {
+				hasValue = true
+				if selectorTime {
+					t = vt
+				}
+			}
+			value = append(value, v)
+		}
+		if hasValue {
+			value[0] = e.formatTime(t)
+			values = append(values, value)
+		}
+	}
+	return columns, values
+}
+
+func mod(a, b int64) int64 {
+	m := a % b
+	if m < 0 {
+		m += b
+	}
+	return m
+}
+
+// aggregate computes the aggregate of the field, and returns the time of the selected point for the selectors.
+func aggregate(call, field string, rows []row) (interface{}, int64) {
+	var (
+		count   int64
+		sum     float64
+		intSum  int64
+		allInts = true
+		sel     interface{}
+		selTime int64
+	)
+
+	for _, r := range rows {
+		v, ok := r.fields[field]
+		if !ok {
+			continue
+		}
+		f, numeric := toFloat(v)
+		if !numeric && call != "count" && call != "first" && call != "last" {
+			continue
+		}
+
+		count++
+		sum += f
+		if i, ok := v.(int64); ok {
+			intSum += i
+		} else {
+			allInts = false
+		}
+
+		switch call {
+		case "first":
+			if sel == nil {
+				sel, selTime = v, r.time
+			}
+		case "last":
+			sel, selTime = v, r.time
+		case "min":
+			if s, _ := toFloat(sel); sel == nil || f < s {
+				sel, selTime = v, r.time
+			}
+		case "max":
+			if s, _ := toFloat(sel); sel == nil || f > s {
+				sel, selTime = v, r.time
+			}
+		}
+	}
+
+	if count == 0 {
+		return nil, 0
+	}
+
+	switch call {
+	case "count":
+		return count, 0
+	case "sum":
+		if allInts {
+			return intSum, 0
+		}
+		return sum, 0
+	case "mean":
+		return sum / float64(count), 0
+	}
+	return sel, selTime
+}
+
+func (e *executor) formatTime(ns int64) interface{} {
+	if e.epoch != "" {
+		return ns / models.GetPrecisionMultiplier(e.epoch)
+	}
+	return time.Unix(0, ns).UTC().Format(time.RFC3339Nano)
+}
+
+func (r row) value(name string) interface{} {
+	if name == "time" {
+		return time.Unix(0, r.time).UTC()
+	}
+	if v, ok := r.fields[name]; ok {
+		return v
+	}
+	if v, ok := r.tags[name]; ok {
+		return v
+	}
+	return nil
+}
+
+func eval(ex expr, r row) interface{} {
+	switch e := ex.(type) {
+	case varRef:
+		return r.value(e.name)
+	case stringLit:
+		return e.v
+	case numberLit:
+		return e.v
+	case boolLit:
+		return e.v
+	case timeLit:
+		return e.t
+	case durationLit:
+		return e.d
+	case regexLit:
+		return e.re
+	case binaryExpr:
+		switch e.op {
+		case "and":
+			return isTrue(eval(e.lhs, r)) && isTrue(eval(e.rhs, r))
+		case "or":
+			return isTrue(eval(e.lhs, r)) || isTrue(eval(e.rhs, r))
+		case "+", "-":
+			return arithmetic(e.op, eval(e.lhs, r), eval(e.rhs, r))
+		}
+		return compare(e.op, eval(e.lhs, r), eval(e.rhs, r))
+	}
+	return nil
+}
+
+func isTrue(v interface{}) bool {
+	b, ok := v.(bool)
+	return ok && b
+}
+
+func arithmetic(op string, a, b interface{}) interface{} {
+	sign := 1
+	if op == "-" {
+		sign = -1
+	}
+
+	if t, ok := toTime(a); ok {
+		if d, ok := b.(time.Duration); ok {
+			return t.Add(time.Duration(sign) * d)
+		}
+	}
+	x, ok1 := toFloat(a)
+	y, ok2 := toFloat(b)
+	if ok1 && ok2 {
+		return x + float64(sign)*y
+	}
+	return nil
+}
+
+func compare(op string, a, b interface{}) bool {
+	if re, ok := b.(*regexp.Regexp); ok {
+		s, _ := a.(string)
+		return re.MatchString(s) == (op == "=~")
+	}
+
+	_, aTime := a.(time.Time)
+	_, bTime := b.(time.Time)
+	if aTime || bTime {
+		x, ok1 := toTime(a)
+		y, ok2 := toTime(b)
+		return ok1 && ok2 && compareOrdered(op, x.UnixNano(), y.UnixNano())
+	}
+
+	// the missing tags compare as the empty string
+	if _, ok := b.(string); ok && a == nil {
+		a = ""
+	}
+	if _, ok := a.(string); ok && b == nil {
+		b = ""
+	}
+
+	switch x := a.(type) {
+	case string:
+		if y, ok := b.(string); ok {
+			return compareOrdered(op, x, y)
+		}
+	case bool:
+		if y, ok := b.(bool); ok {
+			return op == "=" && x == y || (op == "!=" || op == "<>") && x != y
+		}
+	default:
+		x1, ok1 := toFloat(a)
+		y1, ok2 := toFloat(b)
+		if ok1 && ok2 {
+			return compareOrdered(op, x1, y1)
+		}
+	}
+	return false
+}
+
+func compareOrdered[T int64 | float64 | string](op string, x, y T) bool {
+	switch op {
+	case "=":
+		return x == y
+	case "!=", "<>":
+		return x != y
+	case "<":
+		return x < y
+	case "<=":
+		return x <= y
+	case ">":
+		return x > y
+	case ">=":
+		return x >= y
+	}
+	return false
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999", "2006-01-02"}
+
+// toTime converts the time, the time literal string, or the epoch nanoseconds number.
+func toTime(v interface{}) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, true
+	case string:
+		for _, layout := range timeLayouts {
+			if tt, err := time.Parse(layout, strings.TrimSpace(t)); err == nil {
+				return tt, true
+			}
+		}
+	case float64:
+		return time.Unix(0, int64(t)).UTC(), true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,305 @@
+package influxtest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bingoohuang/influx"
+	"github.com/influxdata/influxdb1-client/models"
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+// Exchange is a recorded Query or Write, one per line of the golden jsonl file.
+type Exchange struct {
+	// Op is query or write.
+	Op              string `json:"op"`
+	DB              string `json:"db,omitempty"`
+	RetentionPolicy string `json:"rp,omitempty"`
+	// Precision is the epoch of the query, or the precision of the write.
+	Precision string `json:"precision,omitempty"`
+	// Query is the normalized query text by influx.CleanQuery.
+	Query  string                 `json:"query,omitempty"`
+	Params map[string]interface{} `json:"params,omitempty"`
+	// Lines are the points written in line protocol.
+	Lines    []string         `json:"lines,omitempty"`
+	Response *client.Response `json:"response,omitempty"`
+	Error    string           `json:"error,omitempty"`
+}
+
+// key returns the key to match the exchange on replay, without the timestamps of the written lines
+// when ignoreTimestamps is true.
+func (e Exchange) key(ignoreTimestamps bool) string {
+	prefix := e.Op + "\x00" + e.DB + "\x00" + e.RetentionPolicy + "\x00" + e.Precision + "\x00"
+	if e.Op == "write" {
+		lines := e.Lines
+		if ignoreTimestamps {
+			lines = make([]string, len(e.Lines))
+			for i, line := range e.Lines {
+				lines[i] = withoutTimestamp(line)
+			}
+		}
+		return prefix + strings.Join(lines, "\n")
+	}
+	params, _ := json.Marshal(e.Params)
+	return prefix + e.Query + "\x00" + string(params)
+}
+
+// withoutTimestamp strips the timestamp of the line protocol, e.g. the one of time.Now() in the point.
+func withoutTimestamp(line string) string {
+	points, err := models.ParsePointsString(line)
+	if err != nil || len(points) != 1 {
+		return line
+	}
+	p := points[0]
+	return strings.TrimSuffix(p.String(), " "+strconv.FormatInt(p.UnixNano(), 10))
+}
+
+func (e Exchange) err() error {
+	if e.Error == "" {
+		return nil
+	}
+	return errors.New(e.Error)
+}
+
+func queryExchange(q client.Query) Exchange {
+	var params map[string]interface{}
+	// the params are matched by the JSON form, which is the same after the round trip of the golden file
+	if len(q.Parameters) > 0 {
+		if data, err := json.Marshal(q.Parameters); err == nil {
+			_ = json.Unmarshal(data, &params)
+		}
+	}
+	return Exchange{
+		Op: "query", DB: q.Database, RetentionPolicy: q.RetentionPolicy, Precision: q.Precision,
+		Query: strings.TrimSpace(influx.CleanQuery(q.Command)), Params: params,
+	}
+}
+
+func writeExchange(bp client.BatchPoints) Exchange {
+	e := Exchange{Op: "write", DB: bp.Database(), RetentionPolicy: bp.RetentionPolicy(), Precision: bp.Precision()}
+	for _, p := range bp.Points() {
+		e.Lines = append(e.Lines, p.PrecisionString(bp.Precision()))
+	}
+	return e
+}
+
+// Recorder is a client.Client which records the Query and Write exchanges of the underlying client,
+// and saves them to the golden jsonl file on Close, e.g.
+//
+//	r := influxtest.NewRecorder(realClient, "testdata/cpu.golden.jsonl")
+//	c, _ := influx.New(influx.WithClient(r))
+//	... run the test ...
+//	r.Close()
+type Recorder struct {
+	client.Client
+	path string
+
+	mu        sync.Mutex
+	exchanges []Exchange
+}
+
+// NewRecorder creates the Recorder of the client to the golden file.
+func NewRecorder(c client.Client, path string) *Recorder {
+	return &Recorder{Client: c, path: path}
+}
+
+func (r *Recorder) record(e Exchange) {
+	r.mu.Lock()
+	r.exchanges = append(r.exchanges, e)
+	r.mu.Unlock()
+}
+
+// Query executes the query by the underlying client and records it.
+func (r *Recorder) Query(q client.Query) (*client.Response, error) {
+	rsp, err := r.Client.Query(q)
+	e := queryExchange(q)
+	e.Response = rsp
+	if err != nil {
+		e.Error = err.Error()
+	}
+	r.record(e)
+	return rsp, err
+}
+
+// Write writes the batch by the underlying client and records it.
+func (r *Recorder) Write(bp client.BatchPoints) error {
+	err := r.Client.Write(bp)
+	e := writeExchange(bp)
+	if err != nil {
+		e.Error = err.Error()
+	}
+	r.record(e)
+	return err
+}
+
+// Save saves the recorded exchanges to the golden file.
+func (r *Recorder) Save() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	for _, e := range r.exchanges {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(r.path, b.Bytes(), 0o644)
+}
+
+// Close saves the golden file and closes the underlying client.
+func (r *Recorder) Close() error {
+	if err := r.Save(); err != nil {
+		return err
+	}
+	return r.Client.Close()
+}
+
+// NotRecordedError is reported by the Replayer for the exchange which is not in the golden file.
+type NotRecordedError struct {
+	Exchange Exchange
+	Path     string
+}
+
+func (e *NotRecordedError) Error() string {
+	if e.Exchange.Op == "write" {
+		return fmt.Sprintf("write of %d point(s) to %s is not recorded in %s: %s",
+			len(e.Exchange.Lines), e.Exchange.DB, e.Path, strings.Join(e.Exchange.Lines, "\n"))
+	}
+	return fmt.Sprintf("query %q on %s is not recorded in %s", e.Exchange.Query, e.Exchange.DB, e.Path)
+}
+
+// ReplayOption defines the options of the Replayer.
+type ReplayOption struct {
+	IgnoreTimestamps bool
+}
+
+// ReplayOptionFn defines the replay option func.
+type ReplayOptionFn func(*ReplayOption)
+
+// WithIgnoreTimestamps matches the writes without the timestamps of the points,
+// e.g. for the points of time.Now() which differ from the recorded ones.
+func WithIgnoreTimestamps() ReplayOptionFn {
+	return func(o *ReplayOption) { o.IgnoreTimestamps = true }
+}
+
+// Replayer is a client.Client which replays the exchanges of the golden file recorded by the Recorder.
+// The queries are matched by the database, the retention policy, the epoch, the normalized query text
+// and the parameters, the writes by the database, the retention policy, the precision and the line
+// protocol, including the timestamps unless WithIgnoreTimestamps. The same exchanges recorded several
+// times are replayed in order, with the last one repeated. An unmatched one fails by *NotRecordedError.
+type Replayer struct {
+	path   string
+	option ReplayOption
+
+	mu        sync.Mutex
+	exchanges map[string][]Exchange
+	replayed  map[string]int
+	order     []string
+}
+
+// NewReplayer loads the golden file.
+func NewReplayer(path string, options ...ReplayOptionFn) (*Replayer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Replayer{path: path, exchanges: make(map[string][]Exchange), replayed: make(map[string]int)}
+	for _, f := range options {
+		f(&r.option)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var e Exchange
+		dec := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+		// the same as the influxdb client decodes the responses
+		dec.UseNumber()
+		if err := dec.Decode(&e); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+
+		k := e.key(r.option.IgnoreTimestamps)
+		if _, ok := r.exchanges[k]; !ok {
+			r.order = append(r.order, k)
+		}
+		r.exchanges[k] = append(r.exchanges[k], e)
+	}
+	return r, scanner.Err()
+}
+
+func (r *Replayer) replay(e Exchange) (Exchange, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k := e.key(r.option.IgnoreTimestamps)
+	recorded, ok := r.exchanges[k]
+	if !ok {
+		return e, &NotRecordedError{Exchange: e, Path: r.path}
+	}
+
+	i := r.replayed[k]
+	r.replayed[k]++
+	if i >= len(recorded) {
+		i = len(recorded) - 1
+	}
+	return recorded[i], nil
+}
+
+// Query replays the recorded response of the query.
+func (r *Replayer) Query(q client.Query) (*client.Response, error) {
+	e, err := r.replay(queryExchange(q))
+	if err != nil {
+		return nil, err
+	}
+	return e.Response, e.err()
+}
+
+// QueryAsChunk is unsupported.
+func (r *Replayer) QueryAsChunk(client.Query) (*client.ChunkedResponse, error) {
+	return nil, errors.New("chunked query is unsupported by the replayer")
+}
+
+// Write replays the recorded result of the write.
+func (r *Replayer) Write(bp client.BatchPoints) error {
+	e, err := r.replay(writeExchange(bp))
+	if err != nil {
+		return err
+	}
+	return e.err()
+}
+
+// Ping always succeeds.
+func (r *Replayer) Ping(time.Duration) (time.Duration, string, error) { return 0, Version, nil }
+
+// Close does nothing.
+func (r *Replayer) Close() error { return nil }
+
+// Unreplayed returns the recorded exchanges which have never been replayed, e.g. to check the test coverage.
+func (r *Replayer) Unreplayed() []Exchange {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var exchanges []Exchange
+	for _, k := range r.order {
+		if n := r.replayed[k]; n < len(r.exchanges[k]) {
+			exchanges = append(exchanges, r.exchanges[k][n:]...)
+		}
+	}
+	return exchanges
+}
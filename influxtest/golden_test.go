@@ -0,0 +1,111 @@
+package influxtest_test
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/influx"
+	"github.com/bingoohuang/influx/influxtest"
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	golden := filepath.Join(t.TempDir(), "cpu.golden.jsonl")
+	t0 := time.Date(2021, 12, 9, 4, 30, 0, 0, time.UTC)
+	run := func(c *influx.Cli) ([]cpu, int64, error) {
+		if err := c.WritePoint(cpu{Time: t0, Host: "a", Usage: 1.5}); err != nil {
+			return nil, 0, err
+		}
+		var rows []cpu
+		if err := c.DecodeQuery(`SELECT * FROM cpu`, &rows); err != nil {
+			return nil, 0, err
+		}
+		var count int64
+		err := c.DecodeQuery(`SELECT count(usage) FROM cpu WHERE host = $host`, &count,
+			influx.WithParams(map[string]interface{}{"host": "a"}))
+		return rows, count, err
+	}
+
+	s := influxtest.NewServer("db")
+	inner, err := client.NewHTTPClient(client.HTTPConfig{Addr: s.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := influxtest.NewRecorder(inner, golden)
+	c, err := influx.New(influx.WithClient(r), influx.WithDatabase("db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded, recordedCount, err := run(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	p, err := influxtest.NewReplayer(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err = influx.New(influx.WithClient(p), influx.WithDatabase("db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed, replayedCount, err := run(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(replayed, recorded) || replayedCount != recordedCount || replayedCount != 1 {
+		t.Errorf("replayed %+v %d, recorded %+v %d", replayed, replayedCount, recorded, recordedCount)
+	}
+	if unreplayed := p.Unreplayed(); len(unreplayed) != 0 {
+		t.Errorf("unexpected unreplayed %+v", unreplayed)
+	}
+
+	// the normalized query text is matched
+	var rows []cpu
+	if err := c.DecodeQuery("SELECT *\n\t FROM cpu  ", &rows); err != nil || len(rows) != 1 {
+		t.Errorf("unexpected %v %+v", err, rows)
+	}
+
+	var notRecorded *influxtest.NotRecordedError
+	if err := c.DecodeQuery(`SELECT * FROM mem`, &rows); !errors.As(err, &notRecorded) || notRecorded.Exchange.Query != `SELECT * FROM mem` {
+		t.Errorf("expected not recorded, got %v", err)
+	}
+	if err := c.WritePoint(cpu{Time: t0, Host: "b"}); !errors.As(err, &notRecorded) {
+		t.Errorf("expected not recorded, got %v", err)
+	}
+
+	// the precision and the epoch are matched
+	if err := c.WritePoint(cpu{Time: t0, Host: "a", Usage: 1.5}, influx.WithWritePrecision("s")); !errors.As(err, &notRecorded) {
+		t.Errorf("expected not recorded of another precision, got %v", err)
+	}
+	if _, err := p.Query(client.Query{Command: `SELECT * FROM cpu`, Database: "db", Precision: "s"}); !errors.As(err, &notRecorded) {
+		t.Errorf("expected not recorded of another epoch, got %v", err)
+	}
+
+	// the timestamps are matched unless ignored
+	later := cpu{Time: t0.Add(time.Hour), Host: "a", Usage: 1.5}
+	if err := c.WritePoint(later); !errors.As(err, &notRecorded) {
+		t.Errorf("expected not recorded of another timestamp, got %v", err)
+	}
+	p, err = influxtest.NewReplayer(golden, influxtest.WithIgnoreTimestamps())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err = influx.New(influx.WithClient(p), influx.WithDatabase("db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WritePoint(later); err != nil {
+		t.Errorf("expected the write matched without the timestamp, got %v", err)
+	}
+	if err := c.WritePoint(cpu{Time: t0, Host: "a", Usage: 2}); !errors.As(err, &notRecorded) {
+		t.Errorf("expected not recorded of another field, got %v", err)
+	}
+}
@@ -0,0 +1,743 @@
+package influxtest
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bingoohuang/influx/internal/influxql"
+)
+
+// The statements of the supported InfluxQL subset.
+type (
+	createDatabase   struct{ name string }
+	dropDatabase     struct{ name string }
+	dropMeasurement  struct{ name string }
+	showDatabases    struct{}
+	showMeasurements struct{ db string }
+	showTagKeys      struct {
+		db      string
+		sources []source
+	}
+	showTagValues struct {
+		db      string
+		sources []source
+		keys    []string
+		cond    expr
+	}
+	showFieldKeys struct {
+		db      string
+		sources []source
+	}
+	selectStatement struct {
+		fields      []selectField
+		sources     []source
+		cond        expr
+		groupByAll  bool
+		groupByTags []string
+		groupByTime time.Duration
+		desc        bool
+		limit       int
+		offset      int
+	}
+)
+
+// source is a measurement in the FROM clause.
+type source struct {
+	db, rp, name string
+	regex        *regexp.Regexp
+}
+
+func (s source) match(name string) bool {
+	if s.regex != nil {
+		return s.regex.MatchString(name)
+	}
+	return s.name == name
+}
+
+// selectField is a field, a tag or an aggregate call in the SELECT clause.
+type selectField struct {
+	// name is the field or tag name, or * for all of them.
+	name string
+	// call is the aggregate function name, empty for none.
+	call  string
+	alias string
+}
+
+func (f selectField) column() string {
+	switch {
+	case f.alias != "":
+		return f.alias
+	case f.call != "":
+		return f.call
+	default:
+		return f.name
+	}
+}
+
+var aggregates = map[string]bool{"count": true, "sum": true, "mean": true, "min": true, "max": true, "first": true, "last": true}
+
+// The expressions of the WHERE clause.
+type (
+	expr       interface{}
+	binaryExpr struct {
+		op       string
+		lhs, rhs expr
+	}
+	varRef      struct{ name string }
+	stringLit   struct{ v string }
+	numberLit   struct{ v float64 }
+	boolLit     struct{ v bool }
+	regexLit    struct{ re *regexp.Regexp }
+	durationLit struct{ d time.Duration }
+	timeLit     struct{ t time.Time }
+)
+
+func (p *parser) errorf(t influxql.Token, f string, args ...interface{}) error {
+	return fmt.Errorf("error parsing query: %s at char %d", fmt.Sprintf(f, args...), t.Pos+1)
+}
+
+type parser struct {
+	sc     influxql.Scanner
+	params map[string]interface{}
+	now    time.Time
+}
+
+// parseQuery parses the statements separated by semicolons.
+func parseQuery(q string, params map[string]interface{}, now time.Time) ([]interface{}, error) {
+	p := &parser{sc: influxql.Scanner{Query: q}, params: params, now: now}
+	var statements []interface{}
+	for {
+		t, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case t.Kind == influxql.EOF:
+			return statements, nil
+		case t.IsPunct(";"):
+			p.sc.Skip()
+			continue
+		}
+
+		stmt, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, stmt)
+
+		if t, err = p.next(); err != nil {
+			return nil, err
+		}
+		if t.Kind != influxql.EOF && !t.IsPunct(";") {
+			return nil, p.errorf(t, "found %s, expected ;", t)
+		}
+		if t.Kind == influxql.EOF {
+			return statements, nil
+		}
+	}
+}
+
+func (p *parser) statement() (interface{}, error) {
+	t, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case t.IsKeyword("select"):
+		return p.selectStatement()
+	case t.IsKeyword("create"):
+		if err := p.expectKeyword("database"); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		return createDatabase{name: name}, err
+	case t.IsKeyword("drop"):
+		t, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		switch {
+		case t.IsKeyword("database"):
+			return dropDatabase{name: name}, err
+		case t.IsKeyword("measurement"):
+			return dropMeasurement{name: name}, err
+		}
+		return nil, p.errorf(t, "found %s, expected DATABASE, MEASUREMENT", t)
+	case t.IsKeyword("show"):
+		return p.showStatement()
+	}
+	return nil, p.errorf(t, "found %s, expected SELECT, CREATE, DROP, SHOW", t)
+}
+
+func (p *parser) showStatement() (interface{}, error) {
+	t, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case t.IsKeyword("databases"):
+		return showDatabases{}, nil
+	case t.IsKeyword("measurements"):
+		db, err := p.on()
+		return showMeasurements{db: db}, err
+	case t.IsKeyword("tag"):
+		t, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case t.IsKeyword("keys"):
+			s := showTagKeys{}
+			if s.db, err = p.on(); err == nil {
+				s.sources, err = p.optionalFrom()
+			}
+			return s, err
+		case t.IsKeyword("values"):
+			return p.showTagValues()
+		}
+		return nil, p.errorf(t, "found %s, expected KEYS, VALUES", t)
+	case t.IsKeyword("field"):
+		if err := p.expectKeyword("keys"); err != nil {
+			return nil, err
+		}
+		s := showFieldKeys{}
+		if s.db, err = p.on(); err == nil {
+			s.sources, err = p.optionalFrom()
+		}
+		return s, err
+	}
+	return nil, p.errorf(t, "found %s, expected DATABASES, MEASUREMENTS, TAG, FIELD", t)
+}
+
+func (p *parser) showTagValues() (s showTagValues, err error) {
+	if s.db, err = p.on(); err != nil {
+		return s, err
+	}
+	if s.sources, err = p.optionalFrom(); err != nil {
+		return s, err
+	}
+	if err = p.expectKeyword("with"); err != nil {
+		return s, err
+	}
+	if err = p.expectKeyword("key"); err != nil {
+		return s, err
+	}
+
+	t, err := p.next()
+	if err != nil {
+		return s, err
+	}
+	switch {
+	case t.IsPunct("="):
+		key, err := p.name()
+		if err != nil {
+			return s, err
+		}
+		s.keys = []string{key}
+	case t.IsKeyword("in"):
+		if err := p.expectPunct("("); err != nil {
+			return s, err
+		}
+		for {
+			key, err := p.name()
+			if err != nil {
+				return s, err
+			}
+			s.keys = append(s.keys, key)
+			if t, err = p.next(); err != nil {
+				return s, err
+			}
+			if t.IsPunct(")") {
+				break
+			}
+			if !t.IsPunct(",") {
+				return s, p.errorf(t, "found %s, expected , or )", t)
+			}
+		}
+	default:
+		return s, p.errorf(t, "found %s, expected = or IN", t)
+	}
+
+	s.cond, err = p.optionalWhere()
+	return s, err
+}
+
+// on parses the optional ON db clause.
+func (p *parser) on() (string, error) {
+	if t, err := p.peek(); err != nil || !t.IsKeyword("on") {
+		return "", err
+	}
+	p.sc.Skip()
+	return p.name()
+}
+
+func (p *parser) optionalFrom() ([]source, error) {
+	if t, err := p.peek(); err != nil || !t.IsKeyword("from") {
+		return nil, err
+	}
+	p.sc.Skip()
+	return p.sources()
+}
+
+func (p *parser) optionalWhere() (expr, error) {
+	if t, err := p.peek(); err != nil || !t.IsKeyword("where") {
+		return nil, err
+	}
+	p.sc.Skip()
+	return p.expr()
+}
+
+func (p *parser) selectStatement() (*selectStatement, error) {
+	s := &selectStatement{}
+	for {
+		f, err := p.selectField()
+		if err != nil {
+			return nil, err
+		}
+		s.fields = append(s.fields, f)
+		if t, err := p.peek(); err != nil {
+			return nil, err
+		} else if !t.IsPunct(",") {
+			break
+		}
+		p.sc.Skip()
+	}
+
+	if err := p.expectKeyword("from"); err != nil {
+		return nil, err
+	}
+	var err error
+	if s.sources, err = p.sources(); err != nil {
+		return nil, err
+	}
+	if s.cond, err = p.optionalWhere(); err != nil {
+		return nil, err
+	}
+
+	for {
+		t, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case t.IsKeyword("group"):
+			p.sc.Skip()
+			if err := p.groupBy(s); err != nil {
+				return nil, err
+			}
+		case t.IsKeyword("fill"):
+			// the empty buckets are never filled
+			p.sc.Skip()
+			if err := p.skipParens(); err != nil {
+				return nil, err
+			}
+		case t.IsKeyword("order"):
+			p.sc.Skip()
+			if err := p.orderBy(s); err != nil {
+				return nil, err
+			}
+		case t.IsKeyword("limit"), t.IsKeyword("offset"), t.IsKeyword("slimit"), t.IsKeyword("soffset"):
+			p.sc.Skip()
+			n, err := p.integer()
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case t.IsKeyword("limit"):
+				s.limit = n
+			case t.IsKeyword("offset"):
+				s.offset = n
+			}
+		case t.IsKeyword("tz"):
+			p.sc.Skip()
+			if err := p.skipParens(); err != nil {
+				return nil, err
+			}
+		default:
+			return s, nil
+		}
+	}
+}
+
+func (p *parser) selectField() (f selectField, err error) {
+	t, err := p.next()
+	if err != nil {
+		return f, err
+	}
+
+	switch {
+	case t.IsPunct("*"):
+		f.name = "*"
+	case t.IsName():
+		if next, err := p.peek(); err != nil {
+			return f, err
+		} else if t.Kind == influxql.Ident && next.IsPunct("(") {
+			p.sc.Skip()
+			f.call = strings.ToLower(t.Text)
+			if !aggregates[f.call] {
+				return f, p.errorf(t, "undefined function %s()", t.Text)
+			}
+			if f.name, err = p.name(); err != nil {
+				return f, err
+			}
+			if err := p.expectPunct(")"); err != nil {
+				return f, err
+			}
+		} else {
+			f.name = t.Text
+			if err := p.skipCast(); err != nil {
+				return f, err
+			}
+		}
+	default:
+		return f, p.errorf(t, "found %s, expected field", t)
+	}
+
+	if t, err := p.peek(); err != nil {
+		return f, err
+	} else if t.IsKeyword("as") {
+		p.sc.Skip()
+		f.alias, err = p.name()
+	}
+	return f, err
+}
+
+// skipCast skips the cast like ::field or ::tag.
+func (p *parser) skipCast() error {
+	if t, err := p.peek(); err != nil || !t.IsPunct(":") {
+		return err
+	}
+	p.sc.Skip()
+	if err := p.expectPunct(":"); err != nil {
+		return err
+	}
+	_, err := p.name()
+	return err
+}
+
+func (p *parser) groupBy(s *selectStatement) error {
+	if err := p.expectKeyword("by"); err != nil {
+		return err
+	}
+
+	for {
+		t, err := p.next()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case t.IsPunct("*"):
+			s.groupByAll = true
+		case t.IsKeyword("time"):
+			if err := p.expectPunct("("); err != nil {
+				return err
+			}
+			d, err := p.next()
+			if err != nil {
+				return err
+			}
+			if s.groupByTime, err = parseDuration(d.Text); err != nil || d.Kind != influxql.Number || s.groupByTime <= 0 {
+				return p.errorf(d, "invalid duration %s", d)
+			}
+			if err := p.expectPunct(")"); err != nil {
+				return err
+			}
+		case t.IsName():
+			s.groupByTags = append(s.groupByTags, t.Text)
+		default:
+			return p.errorf(t, "found %s, expected dimension", t)
+		}
+
+		if t, err := p.peek(); err != nil {
+			return err
+		} else if !t.IsPunct(",") {
+			return nil
+		}
+		p.sc.Skip()
+	}
+}
+
+func (p *parser) orderBy(s *selectStatement) error {
+	if err := p.expectKeyword("by"); err != nil {
+		return err
+	}
+	if err := p.expectKeyword("time"); err != nil {
+		return err
+	}
+
+	t, err := p.peek()
+	if err != nil {
+		return err
+	}
+	switch {
+	case t.IsKeyword("desc"):
+		s.desc = true
+		p.sc.Skip()
+	case t.IsKeyword("asc"):
+		p.sc.Skip()
+	}
+	return nil
+}
+
+func (p *parser) skipParens() error {
+	if err := p.expectPunct("("); err != nil {
+		return err
+	}
+	for depth := 1; depth > 0; {
+		t, err := p.next()
+		if err != nil {
+			return err
+		}
+		switch {
+		case t.Kind == influxql.EOF:
+			return p.errorf(t, "found EOF, expected )")
+		case t.IsPunct("("):
+			depth++
+		case t.IsPunct(")"):
+			depth--
+		}
+	}
+	return nil
+}
+
+func (p *parser) integer() (int, error) {
+	t, err := p.next()
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(t.Text)
+	if err != nil || t.Kind != influxql.Number {
+		return 0, p.errorf(t, "found %s, expected integer", t)
+	}
+	return n, nil
+}
+
+// sources parses the comma separated measurements like m, rp.m, db.rp.m, db..m or /regex/.
+func (p *parser) sources() ([]source, error) {
+	var sources []source
+	for {
+		src, err := p.sc.Source()
+		if err != nil {
+			return nil, fmt.Errorf("error parsing query: %w", err)
+		}
+		s := source{db: src.DB, rp: src.RetentionPolicy, name: src.Name}
+		if src.Regex {
+			if s.regex, err = regexp.Compile(src.Name); err != nil {
+				return nil, err
+			}
+		}
+		sources = append(sources, s)
+
+		if t, err := p.peek(); err != nil {
+			return nil, err
+		} else if !t.IsPunct(",") {
+			return sources, nil
+		}
+		p.sc.Skip()
+	}
+}
+
+// expr parses the expression with the precedence OR < AND < comparison < + and -.
+func (p *parser) expr() (expr, error) { return p.binary(0) }
+
+var precedences = [][]string{
+	{"or"},
+	{"and"},
+	{"=", "!=", "<>", "<", "<=", ">", ">=", "=~", "!~"},
+	{"+", "-"},
+}
+
+func (p *parser) binary(level int) (expr, error) {
+	if level == len(precedences) {
+		return p.primary()
+	}
+
+	lhs, err := p.binary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+
+		op := ""
+		for _, o := range precedences[level] {
+			if t.IsPunct(o) || t.IsKeyword(o) {
+				op = strings.ToLower(o)
+			}
+		}
+		if op == "" {
+			return lhs, nil
+		}
+		p.sc.Skip()
+
+		var rhs expr
+		if op == "=~" || op == "!~" {
+			t, err := p.next()
+			if err != nil {
+				return nil, err
+			}
+			if t.Kind != influxql.Regex {
+				return nil, p.errorf(t, "found %s, expected regex", t)
+			}
+			re, err := regexp.Compile(t.Text)
+			if err != nil {
+				return nil, err
+			}
+			rhs = regexLit{re: re}
+		} else if rhs, err = p.binary(level + 1); err != nil {
+			return nil, err
+		}
+		lhs = binaryExpr{op: op, lhs: lhs, rhs: rhs}
+	}
+}
+
+func (p *parser) primary() (expr, error) {
+	t, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case t.IsPunct("("):
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expectPunct(")")
+	case t.IsKeyword("now"):
+		if err := p.expectPunct("("); err != nil {
+			return nil, err
+		}
+		return timeLit{t: p.now}, p.expectPunct(")")
+	case t.IsKeyword("true"), t.IsKeyword("false"):
+		return boolLit{v: t.IsKeyword("true")}, nil
+	case t.IsName():
+		e := varRef{name: t.Text}
+		return e, p.skipCast()
+	case t.Kind == influxql.String:
+		return stringLit{v: t.Text}, nil
+	case t.Kind == influxql.Number:
+		if n, err := strconv.ParseFloat(t.Text, 64); err == nil {
+			return numberLit{v: n}, nil
+		}
+		d, err := parseDuration(t.Text)
+		if err != nil {
+			return nil, p.errorf(t, "invalid number or duration %s", t)
+		}
+		return durationLit{d: d}, nil
+	case t.IsPunct("-"):
+		e, err := p.primary()
+		if err != nil {
+			return nil, err
+		}
+		switch v := e.(type) {
+		case numberLit:
+			return numberLit{v: -v.v}, nil
+		case durationLit:
+			return durationLit{d: -v.d}, nil
+		}
+		return nil, p.errorf(t, "unexpected -")
+	case t.Kind == influxql.Param:
+		v, ok := p.params[t.Text]
+		if !ok {
+			return nil, fmt.Errorf("missing parameter: %s", t.Text)
+		}
+		switch v := v.(type) {
+		case string:
+			return stringLit{v: v}, nil
+		case bool:
+			return boolLit{v: v}, nil
+		case float64:
+			return numberLit{v: v}, nil
+		}
+		return nil, fmt.Errorf("unsupported parameter %s: %v", t.Text, v)
+	}
+	return nil, p.errorf(t, "found %s, expected identifier, string, number, bool", t)
+}
+
+var durationUnits = map[string]time.Duration{
+	"ns": time.Nanosecond, "u": time.Microsecond, "µ": time.Microsecond, "ms": time.Millisecond,
+	"s": time.Second, "m": time.Minute, "h": time.Hour, "d": 24 * time.Hour, "w": 7 * 24 * time.Hour,
+}
+
+// parseDuration parses the InfluxQL duration literal like 5m, 1h30m or 2w.
+func parseDuration(s string) (time.Duration, error) {
+	var d time.Duration
+	for s != "" {
+		i := 0
+		for i < len(s) && influxql.IsDigit(s[i]) {
+			i++
+		}
+		j := i
+		for j < len(s) && !influxql.IsDigit(s[j]) {
+			j++
+		}
+		n, err := strconv.ParseInt(s[:i], 10, 64)
+		unit, ok := durationUnits[s[i:j]]
+		if err != nil || !ok {
+			return 0, fmt.Errorf("invalid duration %s", s)
+		}
+		d += time.Duration(n) * unit
+		s = s[j:]
+	}
+	return d, nil
+}
+
+func (p *parser) expectKeyword(kw string) error {
+	t, err := p.next()
+	if err != nil {
+		return err
+	}
+	if !t.IsKeyword(kw) {
+		return p.errorf(t, "found %s, expected %s", t, strings.ToUpper(kw))
+	}
+	return nil
+}
+
+func (p *parser) expectPunct(punct string) error {
+	t, err := p.next()
+	if err != nil {
+		return err
+	}
+	if !t.IsPunct(punct) {
+		return p.errorf(t, "found %s, expected %s", t, punct)
+	}
+	return nil
+}
+
+func (p *parser) name() (string, error) {
+	t, err := p.next()
+	if err != nil {
+		return "", err
+	}
+	if !t.IsName() && t.Kind != influxql.String {
+		return "", p.errorf(t, "found %s, expected identifier", t)
+	}
+	return t.Text, nil
+}
+
+func (p *parser) peek() (influxql.Token, error) {
+	t, err := p.sc.Peek()
+	if err != nil {
+		return t, fmt.Errorf("error parsing query: %w", err)
+	}
+	return t, nil
+}
+
+func (p *parser) next() (influxql.Token, error) {
+	t, err := p.peek()
+	p.sc.Skip()
+	return t, err
+}
@@ -0,0 +1,426 @@
+// Package influxtest provides an in-memory fake InfluxDB 1.x server for the unit tests,
+// which accepts the line protocol on /write and answers a subset of InfluxQL on /query:
+//
+//	SELECT <fields, tags, *, or count/sum/mean/min/max/first/last(field)> FROM <measurements or /regex/>
+//	    [WHERE <conditions on tags, fields and time>] [GROUP BY <tags, *, time(d)>]
+//	    [ORDER BY time [ASC|DESC]] [LIMIT n] [OFFSET n]
+//	SHOW DATABASES, SHOW MEASUREMENTS, SHOW TAG KEYS, SHOW TAG VALUES WITH KEY, SHOW FIELD KEYS
+//	CREATE DATABASE, DROP DATABASE, DROP MEASUREMENT
+//
+// The points are stored per retention policy, where the databases have only the default autogen one
+// unless created by CreateRetentionPolicy, and the empty GROUP BY time buckets are never filled.
+package influxtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+// Version is the server version reported by the X-Influxdb-Version header.
+const Version = "1.8.10"
+
+// DefaultRetentionPolicy is the retention policy of the databases, used when none is given.
+const DefaultRetentionPolicy = "autogen"
+
+// Server is an in-memory fake InfluxDB server.
+type Server struct {
+	*httptest.Server
+
+	mu  sync.Mutex
+	dbs map[string]*database
+	// Now returns the current time for now() in the queries and the points without timestamps.
+	Now func() time.Time
+}
+
+type database struct {
+	rps map[string]*retentionPolicy
+}
+
+type retentionPolicy struct {
+	measurements map[string]*measurement
+}
+
+type measurement struct {
+	// fieldTypes are the types of the fields, float, integer, unsigned, string or boolean.
+	fieldTypes map[string]string
+	series     map[string]*series
+}
+
+type series struct {
+	key    string
+	tags   map[string]string
+	points map[int64]map[string]interface{}
+}
+
+// NewServer starts a server with the databases created, which should be closed by Close.
+func NewServer(dbs ...string) *Server {
+	s := &Server{dbs: make(map[string]*database), Now: time.Now}
+	for _, db := range dbs {
+		s.createDatabase(db)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ping", s.ping)
+	mux.HandleFunc("/health", s.health)
+	mux.HandleFunc("/write", s.write)
+	mux.HandleFunc("/query", s.query)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// CreateRetentionPolicy creates the retention policy in the existing database.
+func (s *Server) CreateRetentionPolicy(db, rp string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, ok := s.dbs[db]
+	if !ok {
+		return fmt.Errorf("database not found: %q", db)
+	}
+	if _, ok := d.rps[rp]; !ok {
+		d.rps[rp] = &retentionPolicy{measurements: make(map[string]*measurement)}
+	}
+	return nil
+}
+
+// WriteLines writes the points in line protocol with nanosecond timestamps to the default retention policy
+// of the database, e.g. to prepare data.
+func (s *Server) WriteLines(db, lines string) error {
+	return s.WriteLinesRP(db, "", lines)
+}
+
+// WriteLinesRP is WriteLines to the retention policy, the default one when empty.
+func (s *Server) WriteLinesRP(db, rp, lines string) error {
+	points, err := models.ParsePointsWithPrecision([]byte(lines), s.Now().UTC(), "n")
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, err := s.retentionPolicy(db, rp)
+	if err != nil {
+		return err
+	}
+	return r.write(points)
+}
+
+// Lines returns the points of the default retention policy of the database in line protocol
+// with nanosecond timestamps, ordered by measurement, series and time.
+func (s *Server) Lines(db string) []string {
+	return s.LinesRP(db, "")
+}
+
+// LinesRP is Lines of the retention policy, the default one when empty.
+func (s *Server) LinesRP(db, rp string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, err := s.retentionPolicy(db, rp)
+	if err != nil {
+		return nil
+	}
+
+	var lines []string
+	for _, name := range sortedKeys(r.measurements) {
+		m := r.measurements[name]
+		for _, key := range sortedKeys(m.series) {
+			sr := m.series[key]
+			for _, t := range sortedTimes(sr.points) {
+				p, err := models.NewPoint(name, models.NewTags(sr.tags), sr.points[t], time.Unix(0, t))
+				if err == nil {
+					lines = append(lines, p.String())
+				}
+			}
+		}
+	}
+	return lines
+}
+
+func (s *Server) createDatabase(name string) {
+	if _, ok := s.dbs[name]; !ok {
+		s.dbs[name] = &database{rps: map[string]*retentionPolicy{
+			DefaultRetentionPolicy: {measurements: make(map[string]*measurement)},
+		}}
+	}
+}
+
+// retentionPolicy returns the retention policy of the database, the default one when rp is empty.
+func (s *Server) retentionPolicy(db, rp string) (*retentionPolicy, error) {
+	d, ok := s.dbs[db]
+	if !ok {
+		return nil, fmt.Errorf("database not found: %q", db)
+	}
+	if rp == "" {
+		rp = DefaultRetentionPolicy
+	}
+	r, ok := d.rps[rp]
+	if !ok {
+		return nil, fmt.Errorf("retention policy not found: %q", rp)
+	}
+	return r, nil
+}
+
+func (s *Server) ping(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("X-Influxdb-Version", Version)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) health(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("X-Influxdb-Version", Version)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"name": "influxdb", "message": "ready for queries and writes", "status": "pass", "checks": []string{},
+		"version": Version,
+	})
+}
+
+func (s *Server) write(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Influxdb-Version", Version)
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	q := r.URL.Query()
+	db := q.Get("db")
+	if db == "" {
+		writeError(w, http.StatusBadRequest, "database is required")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	precision := q.Get("precision")
+	if precision == "" || precision == "ns" {
+		precision = "n"
+	}
+	points, err := models.ParsePointsWithPrecision(body, s.Now().UTC(), precision)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rp, err := s.retentionPolicy(db, q.Get("rp"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err := rp.write(points); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// write writes the points, the ones conflicting with the existing field types are dropped.
+func (r *retentionPolicy) write(points []models.Point) error {
+	var conflict string
+	dropped := 0
+	for _, p := range points {
+		fields, err := p.Fields()
+		if err != nil {
+			return err
+		}
+
+		name := string(p.Name())
+		m, ok := r.measurements[name]
+		if !ok {
+			m = &measurement{fieldTypes: make(map[string]string), series: make(map[string]*series)}
+			r.measurements[name] = m
+		}
+
+		if c := m.conflict(name, fields); c != "" {
+			if conflict == "" {
+				conflict = c
+			}
+			dropped++
+			continue
+		}
+		for k, v := range fields {
+			m.fieldTypes[k] = fieldType(v)
+		}
+
+		key := string(p.Key())
+		sr, ok := m.series[key]
+		if !ok {
+			sr = &series{key: key, tags: p.Tags().Map(), points: make(map[int64]map[string]interface{})}
+			m.series[key] = sr
+		}
+
+		// the fields of the same series and time are merged
+		t := p.UnixNano()
+		if existing, ok := sr.points[t]; ok {
+			for k, v := range fields {
+				existing[k] = v
+			}
+		} else {
+			sr.points[t] = fields
+		}
+	}
+
+	if conflict != "" {
+		return fmt.Errorf("partial write: %s dropped=%d", conflict, dropped)
+	}
+	return nil
+}
+
+func (m *measurement) conflict(name string, fields models.Fields) string {
+	for k, v := range fields {
+		if existing, ok := m.fieldTypes[k]; ok && existing != fieldType(v) {
+			return fmt.Sprintf("field type conflict: input field %q on measurement %q is type %s, already exists as type %s",
+				k, name, fieldType(v), existing)
+		}
+	}
+	return ""
+}
+
+func fieldType(v interface{}) string {
+	switch v.(type) {
+	case float64:
+		return "float"
+	case int64:
+		return "integer"
+	case uint64:
+		return "unsigned"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+type response struct {
+	Results []result `json:"results,omitempty"`
+	Err     string   `json:"error,omitempty"`
+}
+
+type result struct {
+	StatementID int          `json:"statement_id"`
+	Series      []models.Row `json:"series,omitempty"`
+	Err         string       `json:"error,omitempty"`
+}
+
+func (s *Server) query(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Influxdb-Version", Version)
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var params map[string]interface{}
+	if p := r.FormValue("params"); p != "" {
+		if err := json.Unmarshal([]byte(p), &params); err != nil {
+			writeError(w, http.StatusBadRequest, "error parsing query parameters: "+err.Error())
+			return
+		}
+	}
+
+	statements, err := parseQuery(r.FormValue("q"), params, s.Now().UTC())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	epoch := r.FormValue("epoch")
+	if epoch != "" && models.GetPrecisionMultiplier(epoch) == 1 && epoch != "ns" && epoch != "n" {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid epoch %q", epoch))
+		return
+	}
+
+	s.mu.Lock()
+	rsp := response{Results: make([]result, len(statements))}
+	for i, stmt := range statements {
+		e := &executor{s: s, db: r.FormValue("db"), rp: r.FormValue("rp"), epoch: epoch}
+		rsp.Results[i].StatementID = i
+		if rsp.Results[i].Series, err = e.execute(stmt); err != nil {
+			rsp.Results[i].Err = err.Error()
+		}
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, rsp)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, response{Err: msg})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	data, _ := json.Marshal(v)
+	_, _ = w.Write(append(data, '\n'))
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedTimes(m map[int64]map[string]interface{}) []int64 {
+	times := make([]int64, 0, len(m))
+	for t := range m {
+		times = append(times, t)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	return times
+}
+
+// measurementsOf returns the sorted names of the measurements matching the sources, all when no sources.
+func (r *retentionPolicy) measurementsOf(sources []source) []string {
+	var names []string
+	for _, name := range sortedKeys(r.measurements) {
+		if len(sources) == 0 {
+			names = append(names, name)
+			continue
+		}
+		for _, src := range sources {
+			if src.match(name) {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	return names
+}
+
+// tagKeys returns the sorted tag keys of the measurement.
+func (m *measurement) tagKeys() []string {
+	keys := make(map[string]bool)
+	for _, sr := range m.series {
+		for k := range sr.tags {
+			keys[k] = true
+		}
+	}
+	return sortedKeys(keys)
+}
+
+func joinTags(tags map[string]string, keys []string) string {
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k + "=" + tags[k] + ",")
+	}
+	return b.String()
+}
@@ -0,0 +1,191 @@
+package influxtest_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/influx"
+	"github.com/bingoohuang/influx/influxtest"
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+type cpu struct {
+	_     string `influx:",measurement:cpu"`
+	Time  time.Time
+	Host  string `influx:",tag"`
+	Usage float64
+}
+
+func newCli(t *testing.T, s *influxtest.Server) *influx.Cli {
+	c, err := influx.New(influx.WithAddr(s.URL), influx.WithDatabase("db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestWriteAndSelect(t *testing.T) {
+	s := influxtest.NewServer("db")
+	defer s.Close()
+	c := newCli(t, s)
+
+	t0 := time.Date(2021, 12, 9, 4, 30, 0, 0, time.UTC)
+	for i, host := range []string{"a", "b", "a", "b"} {
+		if err := c.WritePoint(cpu{Time: t0.Add(time.Duration(i) * time.Minute), Host: host, Usage: float64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var all []cpu
+	if err := c.DecodeQuery(`SELECT * FROM cpu`, &all); err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 4 || all[1].Host != "b" || all[3].Usage != 3 || !all[2].Time.Equal(t0.Add(2*time.Minute)) {
+		t.Errorf("unexpected rows %+v", all)
+	}
+
+	var rows []cpu
+	q := `SELECT usage, host FROM "cpu" WHERE host = 'a' AND time >= '2021-12-09T04:31:00Z' ORDER BY time DESC LIMIT 1`
+	if err := c.DecodeQuery(q, &rows); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].Usage != 2 || rows[0].Host != "a" {
+		t.Errorf("unexpected rows %+v", rows)
+	}
+
+	var usages []float64
+	if err := c.DecodeQuery(`SELECT usage FROM cpu WHERE host =~ /^b/ OR usage < 1`, &usages); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(usages, []float64{0, 1, 3}) {
+		t.Errorf("unexpected usages %v", usages)
+	}
+	usages = nil
+	if err := c.DecodeQuery(`SELECT usage FROM /^cp/ WHERE host =~ /^(b|'or)$/`, &usages); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(usages, []float64{1, 3}) {
+		t.Errorf("unexpected usages of the regex source %v", usages)
+	}
+
+	grouped, err := influx.DecodeQueryGrouped[cpu](c, `SELECT * FROM cpu WHERE time > now() - 100000d GROUP BY host`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(grouped) != 2 || grouped[1].Tags["host"] != "b" || len(grouped[1].Rows) != 2 || grouped[1].Rows[0].Host != "b" {
+		t.Errorf("unexpected series %+v", grouped)
+	}
+
+	var means []float64
+	if err := c.DecodeQuery(`SELECT mean(usage) FROM cpu GROUP BY time(2m)`, &means); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(means, []float64{0.5, 2.5}) {
+		t.Errorf("unexpected means %v", means)
+	}
+
+	var count int64
+	if err := c.DecodeQuery(`SELECT count(usage) FROM cpu WHERE host = $host`, &count,
+		influx.WithParams(map[string]interface{}{"host": "b"})); err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("unexpected count %d", count)
+	}
+}
+
+func TestShowAndAdmin(t *testing.T) {
+	s := influxtest.NewServer()
+	defer s.Close()
+	c := newCli(t, s)
+
+	if err := c.WritePointRaw(influx.Point{Measurement: "cpu", Fields: map[string]interface{}{"v": 1.0}}); !errors.Is(err, influx.ErrDatabaseNotFound) {
+		t.Errorf("expected database not found, got %v", err)
+	}
+
+	if _, err := c.Query(client.NewQuery(`CREATE DATABASE db`, "", "")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.WriteLines("db", "cpu,host=a,region=us v=1 1\nmem,host=a free=2i 2\ncpu,host=b v=3 3"); err != nil {
+		t.Fatal(err)
+	}
+
+	var tags map[string][]string
+	var v []float64
+	if err := c.DecodeQuery(`SELECT v FROM cpu`, &v, influx.WithTagsReturn(&tags, 10),
+		influx.WithServerTagValues(), influx.WithTagErrors(influx.TagErrorReturn)); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tags, map[string][]string{"host": {"a", "b"}, "region": {"us"}}) {
+		t.Errorf("unexpected tags %v", tags)
+	}
+
+	var measurements []string
+	if err := c.DecodeQuery(`SHOW MEASUREMENTS`, &measurements); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(measurements, []string{"cpu", "mem"}) {
+		t.Errorf("unexpected measurements %v", measurements)
+	}
+
+	err := c.WritePointRaw(influx.Point{Measurement: "mem", Fields: map[string]interface{}{"free": 1.5}, Time: time.Now()})
+	var conflict *influx.FieldTypeConflictError
+	if !errors.As(err, &conflict) || conflict.Field != "free" || conflict.ExistingType != "integer" {
+		t.Errorf("expected field type conflict, got %v", err)
+	}
+
+	if _, err := c.Query(client.NewQuery(`DROP MEASUREMENT mem`, "db", "")); err != nil {
+		t.Fatal(err)
+	}
+	if lines := s.Lines("db"); !reflect.DeepEqual(lines, []string{"cpu,host=a,region=us v=1 1", "cpu,host=b v=3 3"}) {
+		t.Errorf("unexpected lines %v", lines)
+	}
+
+	rsp, err := c.Query(client.NewQuery(`SELECT v FROM cpu WHERE`, "db", ""))
+	if err == nil && rsp.Error() == nil {
+		t.Error("expected the parse error")
+	}
+}
+
+func TestRetentionPolicies(t *testing.T) {
+	s := influxtest.NewServer("db")
+	defer s.Close()
+	c := newCli(t, s)
+
+	if err := s.CreateRetentionPolicy("db", "oneweek"); err != nil {
+		t.Fatal(err)
+	}
+	t0 := time.Date(2021, 12, 9, 4, 30, 0, 0, time.UTC)
+	if err := c.WritePoint(cpu{Time: t0, Host: "a", Usage: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WithRP("oneweek").WritePoint(cpu{Time: t0, Host: "b", Usage: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WithRP("onemonth").WritePoint(cpu{Time: t0, Host: "c", Usage: 3}); err == nil {
+		t.Error("expected the write to the unknown retention policy failed")
+	}
+
+	for q, host := range map[string]string{
+		`SELECT * FROM cpu`: "a", `SELECT * FROM autogen.cpu`: "a", `SELECT * FROM db.oneweek.cpu`: "b",
+	} {
+		var rows []cpu
+		if err := c.DecodeQuery(q, &rows); err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 1 || rows[0].Host != host {
+			t.Errorf("unexpected rows %+v of %s", rows, q)
+		}
+	}
+
+	var rows []cpu
+	if err := c.DecodeQuery(`SELECT * FROM onemonth.cpu`, &rows); err == nil {
+		t.Error("expected the query of the unknown retention policy failed")
+	}
+
+	if lines := s.LinesRP("db", "oneweek"); !reflect.DeepEqual(lines, []string{"cpu,host=b usage=2 1639024200000000000"}) {
+		t.Errorf("unexpected lines %v", lines)
+	}
+}
@@ -0,0 +1,63 @@
+package influx
+
+import (
+	"context"
+	"time"
+
+	"github.com/influxdata/influxdb1-client/models"
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+// Querier executes the queries.
+type Querier interface {
+	// DecodeQuery executes the query, and decodes the result, see Cli.DecodeQuery.
+	DecodeQuery(q string, result interface{}, options ...QueryOptionFn) error
+	// Query executes the raw query.
+	Query(q client.Query) (*client.Response, error)
+	// QueryChunked executes the query in chunks, see Cli.QueryChunked.
+	QueryChunked(q string, chunkSize int, fn func(series []models.Row) error, options ...QueryOptionFn) error
+}
+
+// Writer writes the points.
+type Writer interface {
+	// WritePoint writes the struct, see Cli.WritePoint.
+	WritePoint(data interface{}, options ...WriteOptionFn) error
+	// WritePointRaw writes the point.
+	WritePointRaw(p Point, options ...WriteOptionFn) error
+	// WritePointsRaw writes the points in batches.
+	WritePointsRaw(points []Point, options ...WriteOptionFn) error
+}
+
+// Admin checks the servers and manages the client.
+type Admin interface {
+	Ping(ctx context.Context) (time.Duration, string, error)
+	Health(ctx context.Context) (*Health, error)
+	ServerInfo(ctx context.Context) (ServerInfo, error)
+	// InvalidateTagKeys invalidates the cached tag keys of the measurement.
+	InvalidateTagKeys(db, measurement string)
+	Close() error
+}
+
+// Scoper scopes the client to a database or a retention policy, without modifying the client itself.
+type Scoper interface {
+	// ForDB returns the client which uses the database, see Cli.WithDB.
+	ForDB(db string) Interface
+	// ForRP returns the client which writes to the retention policy, see Cli.WithRP.
+	ForRP(rp string) Interface
+}
+
+// Interface is the interface of the Cli, to be substituted by the mocks in the tests, e.g. the influxmock package.
+type Interface interface {
+	Querier
+	Writer
+	Admin
+	Scoper
+}
+
+var _ Interface = (*Cli)(nil)
+
+// ForDB is like WithDB, but returns the Interface.
+func (c *Cli) ForDB(db string) Interface { return c.WithDB(db) }
+
+// ForRP is like WithRP, but returns the Interface.
+func (c *Cli) ForRP(rp string) Interface { return c.WithRP(rp) }
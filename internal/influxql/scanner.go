@@ -0,0 +1,187 @@
+// Package influxql is the InfluxQL tokenizer shared by the influx package and the fake server of influxtest.
+package influxql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Kind is the kind of a token.
+type Kind int
+
+const (
+	EOF Kind = iota
+	Ident
+	QuotedIdent
+	String
+	Number
+	// Param is the bound parameter like $host, whose Text is the name without the dollar sign.
+	Param
+	// Regex is the regex literal after =~ or !~, whose Text is the pattern without the slashes.
+	Regex
+	Punct
+)
+
+// Token is a token of the query, at the byte offset Pos.
+type Token struct {
+	Kind Kind
+	Text string
+	Pos  int
+}
+
+func (t Token) IsKeyword(kw string) bool { return t.Kind == Ident && strings.EqualFold(t.Text, kw) }
+func (t Token) IsPunct(p string) bool    { return t.Kind == Punct && t.Text == p }
+func (t Token) IsName() bool             { return t.Kind == Ident || t.Kind == QuotedIdent }
+func (t Token) String() string           { return strconv.Quote(t.Text) }
+
+// Scanner scans the tokens of the query one by one, with a lookahead of one token.
+type Scanner struct {
+	Query string
+	// Pos is the byte offset of the next token to lex, after the peeked one if any.
+	Pos    int
+	peeked *Token
+	prev   Token
+}
+
+// Peek returns the next token without consuming it.
+func (s *Scanner) Peek() (Token, error) {
+	if s.peeked == nil {
+		t, err := s.lex()
+		if err != nil {
+			return t, err
+		}
+		s.peeked = &t
+	}
+	return *s.peeked, nil
+}
+
+// Next consumes the next token.
+func (s *Scanner) Next() (Token, error) {
+	t, err := s.Peek()
+	s.peeked = nil
+	return t, err
+}
+
+// Skip consumes the peeked token.
+func (s *Scanner) Skip() { s.peeked = nil }
+
+// Reset rewinds or forwards the scanner to the byte offset pos.
+func (s *Scanner) Reset(pos int) { s.Pos, s.peeked = pos, nil }
+
+// ReadRegex reads the regex literal after the consumed opening slash until the closing one,
+// e.g. the /regex/ source in the FROM clause.
+func (s *Scanner) ReadRegex() (string, error) {
+	s.peeked = nil
+	var b strings.Builder
+	for ; s.Pos < len(s.Query); s.Pos++ {
+		switch c := s.Query[s.Pos]; {
+		case c == '\\' && s.Pos+1 < len(s.Query) && s.Query[s.Pos+1] == '/':
+			b.WriteByte('/')
+			s.Pos++
+		case c == '/':
+			s.Pos++
+			return b.String(), nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", fmt.Errorf("unclosed regex in %q", s.Query)
+}
+
+var operators = []string{"!=", "<>", "<=", ">=", "=~", "!~"}
+
+func (s *Scanner) lex() (t Token, err error) {
+	defer func() { s.prev = t }()
+
+	for s.Pos < len(s.Query) {
+		if c := rune(s.Query[s.Pos]); unicode.IsSpace(c) {
+			s.Pos++
+		} else if strings.HasPrefix(s.Query[s.Pos:], "--") {
+			if i := strings.IndexByte(s.Query[s.Pos:], '\n'); i >= 0 {
+				s.Pos += i
+			} else {
+				s.Pos = len(s.Query)
+			}
+		} else {
+			break
+		}
+	}
+
+	start := s.Pos
+	if s.Pos >= len(s.Query) {
+		return Token{Kind: EOF, Pos: start}, nil
+	}
+
+	switch c := s.Query[s.Pos]; {
+	case c == '/' && (s.prev.IsPunct("=~") || s.prev.IsPunct("!~")):
+		// the regex literal, whose content may look like keywords or quotes
+		s.Pos++
+		text, err := s.ReadRegex()
+		if err != nil {
+			return Token{}, err
+		}
+		return Token{Kind: Regex, Text: text, Pos: start}, nil
+	case c == '"' || c == '\'':
+		text, err := s.quoted(c)
+		if err != nil {
+			return Token{}, err
+		}
+		kind := QuotedIdent
+		if c == '\'' {
+			kind = String
+		}
+		return Token{Kind: kind, Text: text, Pos: start}, nil
+	case c == '$':
+		s.Pos++
+		for s.Pos < len(s.Query) && isIdentChar(s.Query[s.Pos]) {
+			s.Pos++
+		}
+		return Token{Kind: Param, Text: s.Query[start+1 : s.Pos], Pos: start}, nil
+	case isIdentChar(c) && !IsDigit(c):
+		for s.Pos < len(s.Query) && isIdentChar(s.Query[s.Pos]) {
+			s.Pos++
+		}
+		return Token{Kind: Ident, Text: s.Query[start:s.Pos], Pos: start}, nil
+	case IsDigit(c):
+		for s.Pos < len(s.Query) && (isIdentChar(s.Query[s.Pos]) || s.Query[s.Pos] == '.') {
+			s.Pos++
+		}
+		return Token{Kind: Number, Text: s.Query[start:s.Pos], Pos: start}, nil
+	default:
+		for _, op := range operators {
+			if strings.HasPrefix(s.Query[s.Pos:], op) {
+				s.Pos += len(op)
+				return Token{Kind: Punct, Text: op, Pos: start}, nil
+			}
+		}
+		s.Pos++
+		return Token{Kind: Punct, Text: string(c), Pos: start}, nil
+	}
+}
+
+// quoted reads the quoted text with backslash escapes.
+func (s *Scanner) quoted(quote byte) (string, error) {
+	var b strings.Builder
+	for s.Pos++; s.Pos < len(s.Query); s.Pos++ {
+		switch c := s.Query[s.Pos]; {
+		case c == '\\' && s.Pos+1 < len(s.Query):
+			s.Pos++
+			b.WriteByte(s.Query[s.Pos])
+		case c == quote:
+			s.Pos++
+			return b.String(), nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", fmt.Errorf("unclosed %c in %q", quote, s.Query)
+}
+
+// IsDigit tells whether c is an ASCII digit.
+func IsDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func isIdentChar(c byte) bool {
+	return c == '_' || IsDigit(c) || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
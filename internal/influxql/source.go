@@ -0,0 +1,64 @@
+package influxql
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Source is a measurement in the FROM clause.
+type Source struct {
+	DB              string
+	RetentionPolicy string
+	// Name is the measurement name, or the pattern without the slashes when Regex is set.
+	Name  string
+	Regex bool
+}
+
+// Source parses the measurement like m, rp.m, db.rp.m, db..m or /regex/.
+func (s *Scanner) Source() (Source, error) {
+	var parts []string
+	regex := false
+	for {
+		t, err := s.Peek()
+		if err != nil {
+			return Source{}, err
+		}
+
+		part := ""
+		switch {
+		case t.IsName():
+			s.Skip()
+			part = t.Text
+		case t.IsPunct("/"):
+			s.Skip()
+			if part, err = s.ReadRegex(); err != nil {
+				return Source{}, err
+			}
+			regex = true
+		case !t.IsPunct("."):
+			return Source{}, fmt.Errorf("found %s, expected identifier at char %d", t, t.Pos+1)
+		}
+		parts = append(parts, part)
+
+		if t, err = s.Peek(); err != nil {
+			return Source{}, err
+		}
+		if regex || !t.IsPunct(".") {
+			break
+		}
+		s.Skip()
+	}
+
+	if len(parts) > 3 {
+		return Source{}, fmt.Errorf("too many segments in %s", strings.Join(parts, "."))
+	}
+
+	src := Source{Name: parts[len(parts)-1], Regex: regex}
+	if len(parts) > 1 {
+		src.RetentionPolicy = parts[len(parts)-2]
+	}
+	if len(parts) > 2 {
+		src.DB = parts[0]
+	}
+	return src, nil
+}
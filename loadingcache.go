@@ -1,60 +1,295 @@
 package influx
 
 import (
+	"container/list"
+	"fmt"
 	"sync"
 	"time"
 )
 
-type cacheKey struct {
+// defaultMaxEntries bounds the built-in caches when the max entries is not set, since the expired entries
+// are only removed by the background cleanup if enabled, or evicted as the least recently used ones.
+const defaultMaxEntries = 10000
+
+// CacheKey is the key of the tag keys cache.
+type CacheKey struct {
 	Addr        string
 	DB          string
 	Measurement string
 }
 
-var cache *LoadingCache[cacheKey, map[string]bool]
+// Cache caches the tag keys of the measurements, which *LoadingCache[CacheKey, map[string]bool] implements.
+type Cache interface {
+	// Get returns the cached tag keys, or loads them by the loader when missing or expired.
+	Get(k CacheKey, loader func(k CacheKey) (map[string]bool, error)) (map[string]bool, error)
+	// GetIfPresent returns the cached tag keys without loading.
+	GetIfPresent(k CacheKey) (map[string]bool, bool)
+	// Invalidate removes the cached tag keys.
+	Invalidate(k CacheKey)
+}
+
+// tagValuesKey is the cache key of the tag values of the measurement.
+type tagValuesKey struct {
+	CacheKey
+	// Keys are the sorted and joined tag keys.
+	Keys string
+	// Condition is the time condition of the query.
+	Condition string
+}
+
+// NewTagKeysCache creates the cache of the tag keys, with the least recently used entries evicted
+// when exceeding the maxEntries (10000 if <= 0).
+func NewTagKeysCache(ttl time.Duration, maxEntries int) *LoadingCache[CacheKey, map[string]bool] {
+	if maxEntries <= 0 {
+		maxEntries = defaultMaxEntries
+	}
+	return NewLoadingCache[CacheKey, map[string]bool](ttl, WithMaxEntries(maxEntries), WithErrorTTL(time.Minute))
+}
 
-func init() {
-	cache = NewLoadingCache[cacheKey, map[string]bool](24 * time.Hour)
+func newTagValuesCache() *LoadingCache[tagValuesKey, map[string][]string] {
+	// 标签值变化比标签键频繁，且时间条件可能是相对时间（例如：now() - 5m），因此缓存时间更短
+	return NewLoadingCache[tagValuesKey, map[string][]string](5*time.Minute, WithMaxEntries(defaultMaxEntries))
 }
 
+// LoadingCache is a cache which loads the missing values by the loader.
+// Concurrent loadings of the same key are merged into one, while different keys load in parallel.
 type LoadingCache[K comparable, V any] struct {
-	sync.RWMutex
-	cache map[K]item[V]
-	ttl   time.Duration
+	mu      sync.Mutex
+	entries map[K]*list.Element
+	// lru holds the entries with the most recently used at the front.
+	lru     *list.List
+	loading map[K]*loadingCall[V]
+
+	ttl             time.Duration
+	errorTTL        time.Duration
+	maxEntries      int
+	cleanupInterval time.Duration
+	stop            chan struct{}
+	stopOnce        sync.Once
 }
 
 // cache value.
-type item[V any] struct {
+type item[K comparable, V any] struct {
+	key       K
 	value     V
+	err       error
 	expiresAt time.Time
 }
 
-func NewLoadingCache[K comparable, V any](ttl time.Duration) *LoadingCache[K, V] {
-	return &LoadingCache[K, V]{
-		cache: make(map[K]item[V]),
-		ttl:   ttl,
+// loadingCall is an in-flight loading.
+type loadingCall[V any] struct {
+	wg    sync.WaitGroup
+	value V
+	err   error
+}
+
+// CacheOption defines the options of the LoadingCache.
+type CacheOption struct {
+	MaxEntries      int
+	ErrorTTL        time.Duration
+	CleanupInterval time.Duration
+}
+
+// CacheOptionFn defines the cache option func.
+type CacheOptionFn func(*CacheOption)
+
+// WithMaxEntries bounds the cache size, the least recently used entries are evicted when exceeded.
+func WithMaxEntries(n int) CacheOptionFn { return func(o *CacheOption) { o.MaxEntries = n } }
+
+// WithErrorTTL caches the loading errors for the ttl, 0 (default) for not caching errors.
+func WithErrorTTL(ttl time.Duration) CacheOptionFn { return func(o *CacheOption) { o.ErrorTTL = ttl } }
+
+// WithCleanupInterval removes the expired entries in background every interval, until Close is called.
+func WithCleanupInterval(interval time.Duration) CacheOptionFn {
+	return func(o *CacheOption) { o.CleanupInterval = interval }
+}
+
+func NewLoadingCache[K comparable, V any](ttl time.Duration, options ...CacheOptionFn) *LoadingCache[K, V] {
+	option := &CacheOption{}
+	for _, f := range options {
+		f(option)
+	}
+
+	c := &LoadingCache[K, V]{
+		entries:         make(map[K]*list.Element),
+		lru:             list.New(),
+		loading:         make(map[K]*loadingCall[V]),
+		ttl:             ttl,
+		errorTTL:        option.ErrorTTL,
+		maxEntries:      option.MaxEntries,
+		cleanupInterval: option.CleanupInterval,
+		stop:            make(chan struct{}),
+	}
+
+	if c.cleanupInterval > 0 {
+		go c.cleanup()
 	}
+
+	return c
 }
 
+// Get returns the cached value of k, or loads it by the loader when missing or expired.
 func (c *LoadingCache[K, V]) Get(k K, loader func(k K) (V, error)) (V, error) {
-	c.RLock()
-	v, ok := c.cache[k]
-	c.RUnlock()
-	if ok && v.expiresAt.After(time.Now()) {
-		return v.value, nil
+	return c.GetTTL(k, 0, loader)
+}
+
+// GetTTL is like Get, but caches the loaded value for the ttl instead of the default one, if ttl > 0.
+func (c *LoadingCache[K, V]) GetTTL(k K, ttl time.Duration, loader func(k K) (V, error)) (V, error) {
+	c.mu.Lock()
+	if e, ok := c.entries[k]; ok {
+		it := e.Value.(*item[K, V])
+		if it.expiresAt.After(time.Now()) {
+			c.lru.MoveToFront(e)
+			c.mu.Unlock()
+			return it.value, it.err
+		}
+		c.remove(e)
 	}
 
-	c.Lock()
-	defer c.Unlock()
+	if call, ok := c.loading[k]; ok {
+		c.mu.Unlock()
+		call.wg.Wait()
+		return call.value, call.err
+	}
+
+	call := &loadingCall[V]{}
+	call.wg.Add(1)
+	c.loading[k] = call
+	c.mu.Unlock()
+
+	c.load(k, call, ttl, loader)
+	return call.value, call.err
+}
+
+// load loads the value by the loader. A panic of the loader is reported to the waiters as an error,
+// which is not cached, and then propagated to the caller.
+func (c *LoadingCache[K, V]) load(k K, call *loadingCall[V], ttl time.Duration, loader func(k K) (V, error)) {
+	loaded := false
+	defer func() {
+		var r interface{}
+		if !loaded {
+			r = recover()
+			call.err = fmt.Errorf("cache loader panicked: %v", r)
+		}
+
+		c.mu.Lock()
+		// the loading might be invalidated meanwhile
+		if c.loading[k] == call {
+			delete(c.loading, k)
+			if loaded {
+				c.set(k, call.value, call.err, ttl)
+			}
+		}
+		c.mu.Unlock()
+		call.wg.Done()
+
+		if r != nil {
+			panic(r)
+		}
+	}()
 
-	value, err := loader(k)
+	call.value, call.err = loader(k)
+	loaded = true
+}
+
+// set adds the entry, and evicts the least recently used ones when exceeding the max entries.
+func (c *LoadingCache[K, V]) set(k K, value V, err error, ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = c.ttl
+	}
 	if err != nil {
-		return value, err
+		if c.errorTTL <= 0 {
+			return
+		}
+		ttl = c.errorTTL
+	}
+
+	if e, ok := c.entries[k]; ok {
+		c.remove(e)
+	}
+	c.entries[k] = c.lru.PushFront(&item[K, V]{key: k, value: value, err: err, expiresAt: time.Now().Add(ttl)})
+
+	for c.maxEntries > 0 && c.lru.Len() > c.maxEntries {
+		c.remove(c.lru.Back())
 	}
-	c.cache[k] = item[V]{
-		value:     value,
-		expiresAt: time.Now().Add(c.ttl),
+}
+
+func (c *LoadingCache[K, V]) remove(e *list.Element) {
+	c.lru.Remove(e)
+	delete(c.entries, e.Value.(*item[K, V]).key)
+}
+
+// GetIfPresent returns the cached value of k without loading.
+func (c *LoadingCache[K, V]) GetIfPresent(k K) (v V, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, found := c.entries[k]; found {
+		if it := e.Value.(*item[K, V]); it.err == nil && it.expiresAt.After(time.Now()) {
+			return it.value, true
+		}
 	}
+	return v, false
+}
+
+// Invalidate removes the cached value of k.
+func (c *LoadingCache[K, V]) Invalidate(k K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	return value, nil
+	if e, ok := c.entries[k]; ok {
+		c.remove(e)
+	}
+	delete(c.loading, k)
+}
+
+// Purge removes all the cached values.
+func (c *LoadingCache[K, V]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[K]*list.Element)
+	c.lru.Init()
+	c.loading = make(map[K]*loadingCall[V])
+}
+
+// Len returns the number of the cached entries, including the expired ones not removed yet.
+func (c *LoadingCache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lru.Len()
+}
+
+// Close stops the background cleanup.
+func (c *LoadingCache[K, V]) Close() {
+	c.stopOnce.Do(func() { close(c.stop) })
+}
+
+func (c *LoadingCache[K, V]) cleanup() {
+	ticker := time.NewTicker(c.cleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			c.removeExpired()
+		}
+	}
+}
+
+func (c *LoadingCache[K, V]) removeExpired() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for e := c.lru.Back(); e != nil; {
+		prev := e.Prev()
+		if !e.Value.(*item[K, V]).expiresAt.After(now) {
+			c.remove(e)
+		}
+		e = prev
+	}
 }
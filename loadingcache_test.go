@@ -0,0 +1,148 @@
+package influx_test
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/influx"
+)
+
+func TestLoadingCacheSingleFlight(t *testing.T) {
+	c := influx.NewLoadingCache[string, int](time.Hour)
+
+	var loads int32
+	release := make(chan struct{})
+	slowLoader := func(k string) (int, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		return len(k), nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := c.Get("slow", slowLoader); v != 4 || err != nil {
+				t.Errorf("wrong value %d %v", v, err)
+			}
+		}()
+	}
+
+	// other keys are not blocked by the slow loading
+	if v, _ := c.Get("fast", func(k string) (int, error) { return 1, nil }); v != 1 {
+		t.Errorf("wrong value %d", v)
+	}
+
+	close(release)
+	wg.Wait()
+
+	if loads != 1 {
+		t.Errorf("expected 1 loading, got %d", loads)
+	}
+}
+
+func TestLoadingCacheEviction(t *testing.T) {
+	c := influx.NewLoadingCache[int, int](time.Hour, influx.WithMaxEntries(2))
+
+	var loads int
+	loader := func(k int) (int, error) {
+		loads++
+		return k * 10, nil
+	}
+
+	c.Get(1, loader)
+	c.Get(2, loader)
+	c.Get(1, loader) // 1 is now the most recently used
+	c.Get(3, loader) // evicts 2
+	if c.Len() != 2 {
+		t.Errorf("expected 2 entries, got %d", c.Len())
+	}
+
+	loads = 0
+	c.Get(1, loader)
+	c.Get(2, loader)
+	if loads != 1 {
+		t.Errorf("expected 2 evicted only, got %d loadings", loads)
+	}
+
+	c.Invalidate(2)
+	if c.Len() != 1 {
+		t.Errorf("expected 1 entry after Invalidate, got %d", c.Len())
+	}
+	c.Purge()
+	if c.Len() != 0 {
+		t.Errorf("expected no entries after Purge, got %d", c.Len())
+	}
+}
+
+func TestLoadingCacheExpiration(t *testing.T) {
+	c := influx.NewLoadingCache[int, int](20*time.Millisecond,
+		influx.WithErrorTTL(time.Hour), influx.WithCleanupInterval(5*time.Millisecond))
+	defer c.Close()
+
+	errLoad := errors.New("load failed")
+	var loads int32
+	failing := func(k int) (int, error) {
+		atomic.AddInt32(&loads, 1)
+		return 0, errLoad
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.Get(1, failing); !errors.Is(err, errLoad) {
+			t.Errorf("expected cached error, got %v", err)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("expected the error cached, got %d loadings", loads)
+	}
+
+	c.Get(2, func(k int) (int, error) { return k, nil })
+	time.Sleep(60 * time.Millisecond)
+	if c.Len() != 1 {
+		t.Errorf("expected the expired entry removed in background, got %d entries", c.Len())
+	}
+}
+
+func TestLoadingCachePanic(t *testing.T) {
+	c := influx.NewLoadingCache[string, int](time.Hour)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	panicking := func(k string) (int, error) {
+		close(started)
+		<-release
+		panic("boom")
+	}
+
+	var recovered interface{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer func() { recovered = recover() }()
+		_, _ = c.Get("k", panicking)
+	}()
+
+	<-started
+	waited := make(chan error)
+	go func() {
+		_, err := c.Get("k", func(string) (int, error) { return 1, nil })
+		waited <- err
+	}()
+	// let the waiter join the in-flight loading
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	<-done
+	if recovered != "boom" {
+		t.Errorf("expected the panic propagated to the caller, got %v", recovered)
+	}
+	if err := <-waited; err == nil {
+		t.Error("expected the panic reported to the waiter as an error")
+	}
+	if v, err := c.Get("k", func(string) (int, error) { return 2, nil }); v != 2 || err != nil {
+		t.Errorf("expected the panic not cached, got %d %v", v, err)
+	}
+}
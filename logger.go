@@ -0,0 +1,102 @@
+package influx
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Logger logs the messages with the key-value pairs of args, which *slog.Logger implements.
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// WithLogger set the logger of the Cli, which defaults to the standard log package, nil to discard the logs.
+func WithLogger(logger Logger) ConfigFn {
+	return func(c *Config) {
+		if logger == nil {
+			logger = nopLogger{}
+		}
+		c.Logger = logger
+	}
+}
+
+// stdLogger logs by the standard log package.
+type stdLogger struct{}
+
+func (stdLogger) Debug(msg string, args ...any) { logf("DEBUG", msg, args) }
+func (stdLogger) Info(msg string, args ...any)  { logf("INFO", msg, args) }
+func (stdLogger) Warn(msg string, args ...any)  { logf("WARN", msg, args) }
+func (stdLogger) Error(msg string, args ...any) { logf("ERROR", msg, args) }
+
+func logf(level, msg string, args []any) {
+	var b strings.Builder
+	b.WriteString(level + " " + msg)
+	for i := 0; i < len(args); i += 2 {
+		if i+1 < len(args) {
+			fmt.Fprintf(&b, " %v=%v", args[i], args[i+1])
+		} else {
+			fmt.Fprintf(&b, " %v", args[i])
+		}
+	}
+	log.Print(b.String())
+}
+
+// log returns the logger of the Cli, or the standard one when the Cli is not created by New.
+func (c *Cli) log() Logger {
+	if c.logger == nil {
+		return stdLogger{}
+	}
+	return c.logger
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...any) {}
+func (nopLogger) Info(string, ...any)  {}
+func (nopLogger) Warn(string, ...any)  {}
+func (nopLogger) Error(string, ...any) {}
+
+// TagErrorPolicy is the policy on the failures to look up the tag keys or values from the server,
+// for WithTagsReturn and WithTagHistogramsReturn.
+type TagErrorPolicy int
+
+const (
+	// TagErrorLog logs the failures by the Logger of the Cli, and returns the result without the tags.
+	TagErrorLog TagErrorPolicy = iota
+	// TagErrorIgnore ignores the failures silently.
+	TagErrorIgnore
+	// TagErrorReturn returns the failures as a *TagLookupError, after the result is decoded without the tags.
+	TagErrorReturn
+)
+
+// WithTagErrors set the policy on the failures to look up the tags from the server.
+func WithTagErrors(policy TagErrorPolicy) QueryOptionFn {
+	return func(q *QueryOption) { q.TagErrors = policy }
+}
+
+// TagLookupError is the failure to look up the tag keys or values, the result is decoded without the tags.
+type TagLookupError struct {
+	// Op is OpTagKeys or OpTagValues.
+	Op  Op
+	Err error
+}
+
+func (e *TagLookupError) Error() string { return fmt.Sprintf("%s lookup failed: %v", e.Op, e.Err) }
+func (e *TagLookupError) Unwrap() error { return e.Err }
+
+// tagLookupFailed handles the failure to look up the tags by the policy of the option.
+func (c *Cli) tagLookupFailed(option *QueryOption, op Op, err error) {
+	switch option.TagErrors {
+	case TagErrorIgnore:
+	case TagErrorReturn:
+		if option.tagErr == nil {
+			option.tagErr = &TagLookupError{Op: op, Err: err}
+		}
+	default:
+		c.log().Warn("influx "+string(op)+" lookup failed", "error", err)
+	}
+}
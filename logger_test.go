@@ -0,0 +1,95 @@
+package influx_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bingoohuang/influx"
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+type recordingLogger struct{ lines []string }
+
+func (l *recordingLogger) Debug(msg string, args ...any) { l.log("DEBUG", msg, args) }
+func (l *recordingLogger) Info(msg string, args ...any)  { l.log("INFO", msg, args) }
+func (l *recordingLogger) Warn(msg string, args ...any)  { l.log("WARN", msg, args) }
+func (l *recordingLogger) Error(msg string, args ...any) { l.log("ERROR", msg, args) }
+
+func (l *recordingLogger) log(level, msg string, args []any) {
+	l.lines = append(l.lines, level+" "+msg+" "+fmt.Sprint(args...))
+}
+
+func newTagErrorServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasPrefix(strings.ToLower(r.URL.Query().Get("q")), "show tag keys") {
+			_, _ = w.Write([]byte(`{"results":[{"error":"authorization failed"}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"results":[{"series":[{"name":"cpu","tags":{"host":"a"},"columns":["time","v"],
+			"values":[["2021-12-09T04:31:20Z",1]]}]}]}`))
+	}))
+}
+
+func TestTagErrors(t *testing.T) {
+	ts := newTagErrorServer()
+	defer ts.Close()
+
+	logger := &recordingLogger{}
+	c, err := influx.New(influx.WithAddr(ts.URL), influx.WithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var v []float64
+	var tags map[string][]string
+	if err := c.DecodeQuery(`SELECT v FROM cpu GROUP BY host`, &v, influx.WithTagsReturn(&tags, 10)); err != nil {
+		t.Fatal(err)
+	}
+	if len(logger.lines) != 1 || !strings.Contains(logger.lines[0], "authorization failed") {
+		t.Errorf("expected the warn log of the failure, got %v", logger.lines)
+	}
+
+	err = c.DecodeQuery(`SELECT v FROM cpu GROUP BY host`, &v, influx.WithTagsReturn(&tags, 10),
+		influx.WithTagErrors(influx.TagErrorReturn))
+	var te *influx.TagLookupError
+	if !errors.As(err, &te) || te.Op != influx.OpTagKeys || len(v) != 1 {
+		t.Errorf("expected the *TagLookupError with the decoded result, got %v, %v", err, v)
+	}
+
+	if err := c.DecodeQuery(`SELECT v FROM cpu GROUP BY host`, &v, influx.WithTagsReturn(&tags, 10),
+		influx.WithTagErrors(influx.TagErrorIgnore)); err != nil || len(logger.lines) != 1 {
+		t.Errorf("expected the failure ignored, got %v, %v", err, logger.lines)
+	}
+}
+
+func TestTagErrorsWithoutNew(t *testing.T) {
+	ts := newTagErrorServer()
+	defer ts.Close()
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	hc, err := client.NewHTTPClient(client.HTTPConfig{Addr: ts.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &influx.Cli{Client: hc}
+
+	var v []float64
+	var tags map[string][]string
+	if err := c.DecodeQuery(`SELECT v FROM cpu GROUP BY host`, &v, influx.WithTagsReturn(&tags, 10)); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "WARN influx tag_keys lookup failed") {
+		t.Errorf("expected the failure logged by the standard log, got %q", buf.String())
+	}
+}
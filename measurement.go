@@ -0,0 +1,78 @@
+package influx
+
+import (
+	"reflect"
+	"strings"
+)
+
+// MeasurementMeta is the struct level metadata of a measurement, declared by the measurement marker
+// like `influx:",measurement:cpu,db:telegraf,rp:oneweek"` on a blank field, or the InfluxMeasurement field.
+type MeasurementMeta struct {
+	DB              string
+	RetentionPolicy string
+	Name            string
+}
+
+// Qualified returns the fully qualified and quoted measurement name like "telegraf"."oneweek"."cpu"
+// to be used in the FROM clause of InfluxQL.
+func (m MeasurementMeta) Qualified() string {
+	switch {
+	case m.DB != "":
+		return QuoteIdent(m.DB) + "." + quoteIdentOrEmpty(m.RetentionPolicy) + "." + QuoteIdent(m.Name)
+	case m.RetentionPolicy != "":
+		return QuoteIdent(m.RetentionPolicy) + "." + QuoteIdent(m.Name)
+	default:
+		return QuoteIdent(m.Name)
+	}
+}
+
+// QuoteIdent quotes the InfluxQL identifier with double quotes.
+func QuoteIdent(ident string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(ident) + `"`
+}
+
+func quoteIdentOrEmpty(ident string) string {
+	if ident == "" {
+		return ""
+	}
+	return QuoteIdent(ident)
+}
+
+// MeasurementOf returns the measurement metadata of v, which can be a struct, a slice of structs,
+// or pointers to them. The name defaults to the struct type name.
+func MeasurementOf(v interface{}) (m MeasurementMeta) {
+	t := reflect.TypeOf(v)
+	for t != nil && (t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return m
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		ft := t.Field(i)
+		fd := ParseInfluxTag(ft.Name, ft.Tag.Get("influx"))
+		if ft.Name == InfluxMeasurement || fd.Properties["measurement"] != "" {
+			m.parseMarker(fd)
+		}
+	}
+
+	if m.Name == "" {
+		m.Name = t.Name()
+	}
+
+	return m
+}
+
+// parseMarker reads the properties of the measurement marker.
+func (m *MeasurementMeta) parseMarker(fd *Field) {
+	if v := fd.Properties["measurement"]; v != "" {
+		m.Name = v
+	}
+	if v := fd.Properties["db"]; v != "" {
+		m.DB = v
+	}
+	if v := fd.Properties["rp"]; v != "" {
+		m.RetentionPolicy = v
+	}
+}
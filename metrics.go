@@ -0,0 +1,179 @@
+package influx
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultDurationBuckets are the default upper bounds in seconds of the duration histogram buckets.
+var DefaultDurationBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Metrics is a Hook which collects the Prometheus style metrics of the calls, and exposes them in the
+// Prometheus text format by ServeHTTP, e.g. http.Handle("/metrics/influx", metrics), or WriteTo:
+//
+//	influx_requests_total{op,db,status}                      counter
+//	influx_request_duration_seconds{op,db}                   histogram
+//	influx_points_total{op,db}, influx_bytes_total{op,db}    counter
+type Metrics struct {
+	buckets []float64
+
+	mu      sync.Mutex
+	calls   map[metricsKey]*metricsValue
+	results map[metricsKey]uint64
+}
+
+type metricsKey struct {
+	op     Op
+	db     string
+	status string
+}
+
+type metricsValue struct {
+	counts         []uint64
+	count          uint64
+	sum            float64
+	points, nbytes uint64
+}
+
+// NewMetrics creates the Metrics with the duration histogram buckets, DefaultDurationBuckets if none.
+func NewMetrics(buckets ...float64) *Metrics {
+	if len(buckets) == 0 {
+		buckets = DefaultDurationBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	return &Metrics{buckets: buckets, calls: make(map[metricsKey]*metricsValue), results: make(map[metricsKey]uint64)}
+}
+
+// Observe collects the metrics of the event.
+func (m *Metrics) Observe(e Event) {
+	status := "ok"
+	if e.Err != nil {
+		status = "error"
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.results[metricsKey{op: e.Op, db: e.DB, status: status}]++
+
+	k := metricsKey{op: e.Op, db: e.DB}
+	v, ok := m.calls[k]
+	if !ok {
+		v = &metricsValue{counts: make([]uint64, len(m.buckets))}
+		m.calls[k] = v
+	}
+
+	seconds := e.Duration.Seconds()
+	for i, le := range m.buckets {
+		if seconds <= le {
+			v.counts[i]++
+		}
+	}
+	v.count++
+	v.sum += seconds
+	v.points += uint64(e.Points)
+	v.nbytes += uint64(e.Bytes)
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = m.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	cw := &countingWriter{w: bw}
+
+	fmt.Fprintln(cw, "# HELP influx_requests_total The number of the calls to InfluxDB.")
+	fmt.Fprintln(cw, "# TYPE influx_requests_total counter")
+	for _, k := range sortedMetricsKeys(m.results) {
+		fmt.Fprintf(cw, "influx_requests_total{%s,status=%q} %d\n", k.labels(), k.status, m.results[k])
+	}
+
+	keys := sortedMetricsKeys(m.calls)
+	fmt.Fprintln(cw, "# HELP influx_request_duration_seconds The duration of the calls to InfluxDB.")
+	fmt.Fprintln(cw, "# TYPE influx_request_duration_seconds histogram")
+	for _, k := range keys {
+		v := m.calls[k]
+		for i, le := range m.buckets {
+			fmt.Fprintf(cw, "influx_request_duration_seconds_bucket{%s,le=%q} %d\n",
+				k.labels(), strconv.FormatFloat(le, 'g', -1, 64), v.counts[i])
+		}
+		fmt.Fprintf(cw, "influx_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", k.labels(), v.count)
+		fmt.Fprintf(cw, "influx_request_duration_seconds_sum{%s} %g\n", k.labels(), v.sum)
+		fmt.Fprintf(cw, "influx_request_duration_seconds_count{%s} %d\n", k.labels(), v.count)
+	}
+
+	fmt.Fprintln(cw, "# HELP influx_points_total The number of the points written, or the rows returned.")
+	fmt.Fprintln(cw, "# TYPE influx_points_total counter")
+	for _, k := range keys {
+		fmt.Fprintf(cw, "influx_points_total{%s} %d\n", k.labels(), m.calls[k].points)
+	}
+
+	fmt.Fprintln(cw, "# HELP influx_bytes_total The size of the line protocol written, or the query text.")
+	fmt.Fprintln(cw, "# TYPE influx_bytes_total counter")
+	for _, k := range keys {
+		fmt.Fprintf(cw, "influx_bytes_total{%s} %d\n", k.labels(), m.calls[k].nbytes)
+	}
+
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+	return cw.n, bw.Flush()
+}
+
+func (k metricsKey) labels() string {
+	return `op="` + string(k.op) + `",db="` + escapeLabel(k.db) + `"`
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+
+func sortedMetricsKeys[V any](m map[metricsKey]V) []metricsKey {
+	keys := make([]metricsKey, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.op != b.op {
+			return a.op < b.op
+		}
+		if a.db != b.db {
+			return a.db < b.db
+		}
+		return a.status < b.status
+	})
+	return keys
+}
+
+// countingWriter counts the bytes written, and keeps the first error.
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
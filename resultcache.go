@@ -0,0 +1,121 @@
+package influx
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/influxdata/influxdb1-client/models"
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+// ResultKey is the key of the query result cache.
+type ResultKey struct {
+	Addr            string
+	DB              string
+	RetentionPolicy string
+	Query           string
+	// Params is the JSON of the query parameters.
+	Params string
+	// Epoch is the precision of the epoch timestamps.
+	Epoch string
+}
+
+// WithResultCache enables caching the query results for the ttl by default, with the least recently
+// used entries evicted when exceeding the maxEntries (10000 if <= 0).
+// The results are keyed by the address, the database, the retention policy, the query cleaned by CleanQuery
+// and the parameters.
+func WithResultCache(ttl time.Duration, maxEntries int) ConfigFn {
+	if maxEntries <= 0 {
+		maxEntries = defaultMaxEntries
+	}
+	return func(c *Config) {
+		c.ResultCache = NewLoadingCache[ResultKey, []models.Row](ttl, WithMaxEntries(maxEntries))
+	}
+}
+
+// WithParams set the parameters of the query which are bound to the $name placeholders.
+func WithParams(params map[string]interface{}) QueryOptionFn {
+	return func(q *QueryOption) { q.Params = params }
+}
+
+// WithCacheTTL caches the result of the query for the ttl instead of the default one of WithResultCache.
+func WithCacheTTL(ttl time.Duration) QueryOptionFn { return func(q *QueryOption) { q.CacheTTL = ttl } }
+
+// WithoutCache skips the result cache for the query.
+func WithoutCache() QueryOptionFn { return func(q *QueryOption) { q.NoCache = true } }
+
+// WithCacheTimeBucket replaces now() in the query with the current time truncated to the bucket,
+// so that the time-relative query like time > now() - 5m stays cacheable within the bucket.
+// It only applies when the result is cached.
+func WithCacheTimeBucket(bucket time.Duration) QueryOptionFn {
+	return func(q *QueryOption) { q.CacheTimeBucket = bucket }
+}
+
+// execQuery executes the query, through the result cache if enabled.
+func (c *Cli) execQuery(cq *client.Query, option *QueryOption) ([]models.Row, error) {
+	if c.resultCache == nil || option.NoCache {
+		return c.querySeries(*cq)
+	}
+
+	// the bucketed query is executed, while the caller keeps the original one
+	bq := *cq
+	if option.CacheTimeBucket > 0 {
+		bq.Command = BucketNow(bq.Command, time.Now(), option.CacheTimeBucket)
+	}
+
+	params, err := json.Marshal(bq.Parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	key := ResultKey{Addr: c.Addr, DB: bq.Database, RetentionPolicy: bq.RetentionPolicy,
+		Query: CleanQuery(bq.Command), Params: string(params), Epoch: bq.Precision}
+	series, err := c.resultCache.GetTTL(key, option.CacheTTL, func(ResultKey) ([]models.Row, error) {
+		return c.querySeries(bq)
+	})
+	if err != nil {
+		return nil, err
+	}
+	// every caller gets its own copy, which may be modified, e.g. by decoding into *[]models.Row
+	return copyRows(series), nil
+}
+
+// copyRows deep copies the rows, down to the values of each row.
+func copyRows(rows []models.Row) []models.Row {
+	if rows == nil {
+		return nil
+	}
+
+	copied := make([]models.Row, len(rows))
+	for i, r := range rows {
+		copied[i] = models.Row{Name: r.Name, Partial: r.Partial,
+			Columns: append([]string(nil), r.Columns...), Values: make([][]interface{}, len(r.Values))}
+		if r.Tags != nil {
+			copied[i].Tags = make(map[string]string, len(r.Tags))
+			for k, v := range r.Tags {
+				copied[i].Tags[k] = v
+			}
+		}
+		for j, values := range r.Values {
+			copied[i].Values[j] = append([]interface{}(nil), values...)
+		}
+	}
+	return copied
+}
+
+// querySeries executes the query and returns the series of the first result.
+func (c *Cli) querySeries(cq client.Query) ([]models.Row, error) {
+	response, err := c.Query(cq)
+	if err != nil {
+		return nil, wrapServerError(err)
+	}
+	if err := response.Error(); err != nil {
+		return nil, wrapServerError(err)
+	}
+
+	if len(response.Results) == 0 {
+		return nil, nil
+	}
+
+	return response.Results[0].Series, nil
+}
@@ -0,0 +1,121 @@
+package influx
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+// Series is one series of a query result, typically one group of a GROUP BY query,
+// with its rows decoded into T.
+type Series[T any] struct {
+	Name string
+	Tags map[string]string
+	Rows []T
+}
+
+// Key returns the series key like cpu,host=a,region=us which identifies the series,
+// with the commas, equal signs and spaces escaped like the line protocol.
+func (s Series[T]) Key() string { return seriesKey(s.Name, s.Tags) }
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	tagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+)
+
+func seriesKey(name string, tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(measurementEscaper.Replace(name))
+	for _, k := range keys {
+		b.WriteString("," + tagEscaper.Replace(k) + "=" + tagEscaper.Replace(tags[k]))
+	}
+	return b.String()
+}
+
+// DecodeGrouped decodes each series of influxResult separately, keeping the name and the tag set
+// of the series alongside its decoded rows. T is the row type, e.g. a struct or map[string]interface{}.
+func DecodeGrouped[T any](influxResult []models.Row, option *QueryOption) ([]Series[T], error) {
+	if option == nil {
+		option = &QueryOption{}
+	}
+
+	collectTags(influxResult, option)
+
+	seriesOption := *option
+	seriesOption.ReturnTags = nil
+	seriesOption.ReturnTagHistograms = nil
+
+	var strictErr *StrictDecodeError
+	var seriesErr *StrictDecodeError
+	grouped := make([]Series[T], 0, len(influxResult))
+	for _, row := range influxResult {
+		s := Series[T]{Name: row.Name, Tags: row.Tags, Rows: make([]T, 0, len(row.Values))}
+		if err := DecodeOption([]models.Row{row}, &s.Rows, &seriesOption); err != nil {
+			// strict errors are merged and reported after all series are decoded
+			if !errors.As(err, &seriesErr) {
+				return nil, err
+			}
+			if strictErr == nil {
+				strictErr = &StrictDecodeError{}
+			}
+			strictErr.merge(seriesKey(row.Name, row.Tags), seriesErr)
+		}
+		grouped = append(grouped, s)
+	}
+
+	if strictErr != nil {
+		return grouped, strictErr
+	}
+
+	return grouped, nil
+}
+
+// DecodeQueryGrouped executes the query like Cli.DecodeQuery, and decodes the result by DecodeGrouped.
+// With a Querier other than *Cli, e.g. a mock, the series are got by its DecodeQuery into *[]models.Row,
+// without the database and retention policy of the measurement of T.
+func DecodeQueryGrouped[T any](querier Querier, q string, options ...QueryOptionFn) ([]Series[T], error) {
+	option := newQueryOption(options)
+	c, ok := querier.(*Cli)
+	if !ok {
+		return decodeQueryGrouped[T](querier, q, option, options)
+	}
+
+	option.measurement = MeasurementOf(new(T))
+	series, err := c.query(q, option)
+	if err != nil {
+		return nil, err
+	}
+
+	grouped, err := DecodeGrouped[T](series, option)
+	if err != nil {
+		return grouped, err
+	}
+	return grouped, option.tagErrOrNil()
+}
+
+func decodeQueryGrouped[T any](querier Querier, q string, option *QueryOption, options []QueryOptionFn) ([]Series[T], error) {
+	var series []models.Row
+	err := querier.DecodeQuery(q, &series, options...)
+	var tagErr *TagLookupError
+	if err != nil && !errors.As(err, &tagErr) {
+		return nil, err
+	}
+
+	// the tags are already collected by DecodeQuery
+	seriesOption := *option
+	seriesOption.ReturnTags = nil
+	seriesOption.ReturnTagHistograms = nil
+	grouped, err := DecodeGrouped[T](series, &seriesOption)
+	if err != nil || tagErr == nil {
+		return grouped, err
+	}
+	return grouped, tagErr
+}
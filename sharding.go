@@ -0,0 +1,339 @@
+package influx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/influxdb1-client/models"
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+// WithShards shards the writes across the InfluxDB instances at addrs by the consistent hash of
+// the measurement plus the values of shardTags (all tags when empty), and scatters the queries to all
+// the shards, merging the series of the same name and tags, ordered by time.
+//
+// The merge is suitable for the raw (non aggregated) queries, since an aggregation like count(x)
+// yields one partial result per shard. ORDER BY time DESC, LIMIT and SLIMIT are applied again to
+// the merged results, while OFFSET and SOFFSET fail by ErrOffsetUnsupported. It takes precedence over WithAddrs.
+func WithShards(shardTags []string, addrs ...string) ConfigFn {
+	return func(c *Config) {
+		c.ShardTags = shardTags
+		c.Shards = addrs
+	}
+}
+
+var (
+	// ErrChunkedUnsupported is reported by the chunked queries in the sharded mode.
+	ErrChunkedUnsupported = errors.New("chunked query is unsupported in the sharded mode")
+	// ErrOffsetUnsupported is reported by the queries with OFFSET or SOFFSET in the sharded mode,
+	// since the rows or series to skip are not known until the results of all shards are merged.
+	ErrOffsetUnsupported = errors.New("OFFSET and SOFFSET are unsupported in the sharded mode")
+)
+
+// hashRing is a consistent hash ring with virtual nodes.
+type hashRing struct {
+	hashes []uint32
+	shards map[uint32]int
+}
+
+const virtualNodes = 160
+
+func newHashRing(addrs []string) *hashRing {
+	r := &hashRing{shards: make(map[uint32]int)}
+	for i, addr := range addrs {
+		for v := 0; v < virtualNodes; v++ {
+			h := hash32(addr + "#" + strconv.Itoa(v))
+			if _, ok := r.shards[h]; !ok {
+				r.shards[h] = i
+				r.hashes = append(r.hashes, h)
+			}
+		}
+	}
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+	return r
+}
+
+// shard returns the index of the shard which the key belongs to.
+func (r *hashRing) shard(key string) int {
+	h := hash32(key)
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.shards[r.hashes[i]]
+}
+
+// hash32 hashes by FNV-1a, followed by the murmur3 finalizer to spread the similar keys,
+// like cpu,host=a and cpu,host=b, across the ring.
+func hash32(s string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(s))
+	x := h.Sum32()
+	x ^= x >> 16
+	x *= 0x85ebca6b
+	x ^= x >> 13
+	x *= 0xc2b2ae35
+	x ^= x >> 16
+	return x
+}
+
+// shardedClient is a client.Client over the shards.
+type shardedClient struct {
+	addrs     []string
+	shards    []client.Client
+	shardTags []string
+	ring      *hashRing
+}
+
+func newShardedClient(c *Config) (*shardedClient, error) {
+	s := &shardedClient{addrs: c.Shards, shardTags: c.ShardTags, ring: newHashRing(c.Shards)}
+	for _, addr := range c.Shards {
+		hc, err := c.newHTTPClient(addr)
+		if err != nil {
+			return nil, err
+		}
+		s.shards = append(s.shards, hc)
+	}
+	return s, nil
+}
+
+// ShardKey returns the key to hash for the point, which is the measurement plus the sorted shard tags.
+func ShardKey(measurement string, tags map[string]string, shardTags []string) string {
+	keys := shardTags
+	if len(keys) == 0 {
+		keys = make([]string, 0, len(tags))
+		for k := range tags {
+			keys = append(keys, k)
+		}
+	}
+	keys = append([]string(nil), keys...)
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(measurement)
+	for _, k := range keys {
+		b.WriteString("," + k + "=" + tags[k])
+	}
+	return b.String()
+}
+
+func (s *shardedClient) Write(bp client.BatchPoints) error {
+	batches := make(map[int]client.BatchPoints)
+	for _, p := range bp.Points() {
+		i := s.ring.shard(ShardKey(p.Name(), p.Tags(), s.shardTags))
+		if _, ok := batches[i]; !ok {
+			b, err := client.NewBatchPoints(client.BatchPointsConfig{
+				Precision:        bp.Precision(),
+				Database:         bp.Database(),
+				RetentionPolicy:  bp.RetentionPolicy(),
+				WriteConsistency: bp.WriteConsistency(),
+			})
+			if err != nil {
+				return err
+			}
+			batches[i] = b
+		}
+		batches[i].AddPoint(p)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	e := &MultiWriteError{Errors: make(map[string]error)}
+	for i, b := range batches {
+		wg.Add(1)
+		go func(i int, b client.BatchPoints) {
+			defer wg.Done()
+			err := s.shards[i].Write(b)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				e.Errors[s.addrs[i]] = err
+			} else {
+				e.Succeeded++
+			}
+		}(i, b)
+	}
+	wg.Wait()
+
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	if len(batches) == 1 {
+		for _, err := range e.Errors {
+			return err
+		}
+	}
+	return e.wrapServerErrors()
+}
+
+func (s *shardedClient) Query(q client.Query) (*client.Response, error) {
+	clauses, err := parseStatementClauses(q.Command)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range clauses {
+		if c.offset > 0 || c.soffset > 0 {
+			return nil, ErrOffsetUnsupported
+		}
+	}
+
+	responses := make([]*client.Response, len(s.shards))
+	errs := make([]error, len(s.shards))
+
+	var wg sync.WaitGroup
+	for i, c := range s.shards {
+		wg.Add(1)
+		go func(i int, c client.Client) {
+			defer wg.Done()
+			responses[i], errs[i] = c.Query(q)
+		}(i, c)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("shard %s: %w", s.addrs[i], err)
+		}
+		if responses[i].Error() != nil {
+			return responses[i], nil
+		}
+	}
+
+	return mergeResponses(clauses, responses), nil
+}
+
+func (s *shardedClient) QueryAsChunk(client.Query) (*client.ChunkedResponse, error) {
+	return nil, ErrChunkedUnsupported
+}
+
+func (s *shardedClient) Ping(timeout time.Duration) (d time.Duration, version string, err error) {
+	for i, c := range s.shards {
+		sd, sv, e := c.Ping(timeout)
+		if e != nil {
+			return 0, "", fmt.Errorf("shard %s: %w", s.addrs[i], e)
+		}
+		if sd > d {
+			d = sd
+		}
+		if version == "" {
+			version = sv
+		}
+	}
+	return d, version, nil
+}
+
+func (s *shardedClient) Close() error {
+	var err error
+	for _, c := range s.shards {
+		if e := c.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// mergeResponses merges the results of the statements from the shards, the series of the same name
+// and tags are merged into one, with the values ordered by time and limited by the clauses of the statement.
+func mergeResponses(clauses []statementClauses, responses []*client.Response) *client.Response {
+	merged := &client.Response{}
+	for _, rsp := range responses {
+		for i, r := range rsp.Results {
+			if i >= len(merged.Results) {
+				merged.Results = append(merged.Results, client.Result{StatementId: r.StatementId})
+			}
+			m := &merged.Results[i]
+			m.Messages = append(m.Messages, r.Messages...)
+			m.Series = mergeSeries(m.Series, r.Series)
+		}
+	}
+
+	for i := range merged.Results {
+		var c statementClauses
+		if i < len(clauses) {
+			c = clauses[i]
+		}
+		r := &merged.Results[i]
+		if c.slimit > 0 && len(r.Series) > c.slimit {
+			// the series are ordered by the name and tags, as InfluxDB does
+			sort.SliceStable(r.Series, func(a, b int) bool {
+				return seriesKey(r.Series[a].Name, r.Series[a].Tags) < seriesKey(r.Series[b].Name, r.Series[b].Tags)
+			})
+			r.Series = r.Series[:c.slimit]
+		}
+		for j := range r.Series {
+			sortByTime(&r.Series[j], c.desc, c.limit)
+		}
+	}
+
+	return merged
+}
+
+func mergeSeries(merged, series []models.Row) []models.Row {
+	for _, s := range series {
+		key := seriesKey(s.Name, s.Tags)
+		found := false
+		for j := range merged {
+			if seriesKey(merged[j].Name, merged[j].Tags) == key &&
+				strings.Join(merged[j].Columns, ",") == strings.Join(s.Columns, ",") {
+				merged[j].Values = append(merged[j].Values, s.Values...)
+				found = true
+				break
+			}
+		}
+		if !found {
+			s.Values = append([][]interface{}(nil), s.Values...)
+			merged = append(merged, s)
+		}
+	}
+	return merged
+}
+
+// sortByTime sorts the values of the series by the time column, and truncates them to the limit if > 0.
+func sortByTime(s *models.Row, desc bool, limit int) {
+	col := -1
+	for i, c := range s.Columns {
+		if c == "time" {
+			col = i
+		}
+	}
+
+	if col >= 0 {
+		sort.SliceStable(s.Values, func(i, j int) bool {
+			ti, tj := timeValue(s.Values[i][col]), timeValue(s.Values[j][col])
+			if desc {
+				return ti > tj
+			}
+			return ti < tj
+		})
+	}
+
+	if limit > 0 && len(s.Values) > limit {
+		s.Values = s.Values[:limit]
+	}
+}
+
+// timeValue converts the time column value, RFC3339 string or epoch number, to a comparable number.
+func timeValue(v interface{}) int64 {
+	switch t := v.(type) {
+	case string:
+		if tt, err := time.Parse(time.RFC3339Nano, t); err == nil {
+			return tt.UnixNano()
+		}
+	case json.Number:
+		if n, err := t.Int64(); err == nil {
+			return n
+		}
+	case float64:
+		return int64(t)
+	case int64:
+		return t
+	}
+	return 0
+}
@@ -0,0 +1,221 @@
+package influx_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/influx"
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+type shardServer struct {
+	*httptest.Server
+	mu    sync.Mutex
+	lines []string
+	// writeErr is the body of the failed writes, which succeed when empty.
+	writeErr string
+}
+
+func newShardServer(response string) *shardServer {
+	s := newUnstartedShardServer(response)
+	s.Start()
+	return s
+}
+
+func newUnstartedShardServer(response string) *shardServer {
+	s := &shardServer{}
+	s.Server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/write" {
+			body, _ := io.ReadAll(r.Body)
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if s.writeErr != "" {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(s.writeErr))
+				return
+			}
+			s.lines = append(s.lines, strings.Split(strings.TrimSpace(string(body)), "\n")...)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(response))
+	}))
+	return s
+}
+
+// newShardServerAt starts the shard server at the fixed addr, to hash the same across the runs.
+func newShardServerAt(t *testing.T, addr string) *shardServer {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("listen %s: %v", addr, err)
+	}
+	s := newUnstartedShardServer("")
+	s.Listener.Close()
+	s.Listener = l
+	s.Start()
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestShardedWrite(t *testing.T) {
+	addrs := []string{"127.0.0.1:38086", "127.0.0.1:38087", "127.0.0.1:38088"}
+	servers := make([]*shardServer, len(addrs))
+	for i, addr := range addrs {
+		servers[i] = newShardServerAt(t, addr)
+		addrs[i] = servers[i].URL
+	}
+
+	c, err := influx.New(influx.WithShards([]string{"host"}, addrs...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hosts := strings.Split("abcdefghijklmnop", "")
+	for round := 0; round < 2; round++ {
+		for i, h := range hosts {
+			p := influx.Point{Measurement: "cpu", Tags: map[string]string{"host": h, "cpu": string(rune('0' + i))},
+				Fields: map[string]interface{}{"v": i}, Time: time.Now()}
+			if err := c.WritePointRaw(p); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// the spread is fixed by the addresses hashed on the ring
+	expected := []int{18, 8, 6}
+	for i, s := range servers {
+		if len(s.lines) != expected[i] {
+			t.Errorf("expected %d points on shard %d, got %d", expected[i], i, len(s.lines))
+		}
+		// the points of the same host always go to the same shard
+		seen := make(map[string]int)
+		for _, l := range s.lines {
+			seen[strings.Split(l, " ")[0]]++
+		}
+		for series, n := range seen {
+			if n != 2 {
+				t.Errorf("series %s is split across shards", series)
+			}
+		}
+	}
+}
+
+func TestShardedWriteErrors(t *testing.T) {
+	addrs := []string{"127.0.0.1:38086", "127.0.0.1:38087", "127.0.0.1:38088"}
+	servers := make([]*shardServer, len(addrs))
+	for i, addr := range addrs {
+		servers[i] = newShardServerAt(t, addr)
+		addrs[i] = servers[i].URL
+	}
+	servers[0].writeErr = `{"error":"database not found: \"db\""}`
+	servers[1].writeErr = `{"error":"partial write: field type conflict: input field \"v\" on measurement \"cpu\" is type float, already exists as type integer dropped=1"}`
+
+	c, err := influx.New(influx.WithShards([]string{"host"}, addrs...), influx.WithDatabase("db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var points []influx.Point
+	for i, h := range strings.Split("abcdefghijklmnop", "") {
+		points = append(points, influx.Point{Measurement: "cpu", Tags: map[string]string{"host": h, "cpu": string(rune('0' + i))},
+			Fields: map[string]interface{}{"v": i}, Time: time.Now()})
+	}
+	err = c.WritePointsRaw(points)
+
+	var me *influx.MultiWriteError
+	if !errors.As(err, &me) || len(me.Errors) != 2 || me.Succeeded != 1 {
+		t.Fatalf("expected *MultiWriteError of 2 shards, got %v", err)
+	}
+	var fe *influx.FieldTypeConflictError
+	var pe *influx.PartialWriteError
+	if !errors.Is(err, influx.ErrDatabaseNotFound) || !errors.As(err, &fe) || !errors.As(err, &pe) || pe.Dropped != 1 {
+		t.Errorf("expected the typed errors of the shards, got %v", err)
+	}
+	if strings.Contains(err.Error(), `{"error"`) {
+		t.Errorf("expected the messages without the JSON bodies, got %v", err)
+	}
+}
+
+func TestShardedQuery(t *testing.T) {
+	s1 := newShardServer(`{"results":[{"series":[{"name":"cpu","tags":{"region":"us"},"columns":["time","v"],"values":[
+		["2021-12-09T04:31:20Z",1],["2021-12-09T04:31:23Z",4]]}]}]}`)
+	s2 := newShardServer(`{"results":[{"series":[{"name":"cpu","tags":{"region":"us"},"columns":["time","v"],"values":[
+		["2021-12-09T04:31:21.5Z",2],["2021-12-09T04:31:22Z",3]]}]}]}`)
+	defer s1.Close()
+	defer s2.Close()
+
+	c, err := influx.New(influx.WithShards(nil, s1.URL, s2.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var v []float64
+	if err := c.DecodeQuery(`SELECT v FROM cpu GROUP BY region`, &v); err != nil {
+		t.Fatal(err)
+	}
+	if len(v) != 4 || v[0] != 1 || v[1] != 2 || v[2] != 3 || v[3] != 4 {
+		t.Errorf("expected merged rows ordered by time, got %v", v)
+	}
+
+	var desc []float64
+	if err := c.DecodeQuery(`SELECT v FROM cpu GROUP BY region ORDER BY time DESC LIMIT 3`, &desc); err != nil {
+		t.Fatal(err)
+	}
+	if len(desc) != 3 || desc[0] != 4 || desc[2] != 2 {
+		t.Errorf("expected merged rows ordered by time desc and limited, got %v", desc)
+	}
+
+	// the clauses in the comments, identifiers and strings are not the ones of the statement
+	v = nil
+	q := `SELECT v AS "order by time desc" FROM cpu WHERE host != 'limit 1' GROUP BY region -- ORDER BY time DESC LIMIT 1`
+	if err := c.DecodeQuery(q, &v); err != nil {
+		t.Fatal(err)
+	}
+	if len(v) != 4 || v[0] != 1 || v[3] != 4 {
+		t.Errorf("expected all rows ordered by time, got %v", v)
+	}
+
+	if err := c.DecodeQuery(`SELECT v FROM cpu GROUP BY region LIMIT 3 OFFSET 1`, &v); !errors.Is(err, influx.ErrOffsetUnsupported) {
+		t.Errorf("expected ErrOffsetUnsupported, got %v", err)
+	}
+}
+
+func TestShardedQueryStatements(t *testing.T) {
+	s1 := newShardServer(`{"results":[
+		{"statement_id":0,"series":[{"name":"cpu","tags":{"region":"us"},"columns":["time","v"],"values":[["2021-12-09T04:31:20Z",1]]}]},
+		{"statement_id":1,"series":[{"name":"cpu","tags":{"region":"us"},"columns":["time","v"],"values":[["2021-12-09T04:31:20Z",1]]}]}]}`)
+	s2 := newShardServer(`{"results":[
+		{"statement_id":0,"series":[{"name":"cpu","tags":{"region":"eu"},"columns":["time","v"],"values":[["2021-12-09T04:31:21Z",2]]}]},
+		{"statement_id":1,"series":[{"name":"cpu","tags":{"region":"us"},"columns":["time","v"],"values":[["2021-12-09T04:31:21Z",2]]}]}]}`)
+	defer s1.Close()
+	defer s2.Close()
+
+	c, err := influx.New(influx.WithShards(nil, s1.URL, s2.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsp, err := c.Client.Query(client.Query{Command: `SELECT v FROM cpu GROUP BY region SLIMIT 1; SELECT v FROM cpu ORDER BY time DESC`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rsp.Results) != 2 {
+		t.Fatalf("expected 2 results, got %+v", rsp.Results)
+	}
+	if series := rsp.Results[0].Series; len(series) != 1 || series[0].Tags["region"] != "eu" {
+		t.Errorf("expected the first series limited by SLIMIT, got %+v", series)
+	}
+	if series := rsp.Results[1].Series; len(series) != 1 || len(series[0].Values) != 2 || series[0].Values[0][1] != json.Number("2") {
+		t.Errorf("expected the rows of the second statement ordered by time desc, got %+v", series)
+	}
+}
@@ -0,0 +1,154 @@
+package influx
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/bingoohuang/gg/pkg/mapstruct"
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+// StrictDecodeError is returned by decoding with WithStrictDecode when the result
+// and the destination struct do not match exactly.
+type StrictDecodeError struct {
+	// UnmappedColumns are the result columns (or series tags) which have no matching struct field.
+	UnmappedColumns []string
+	// MissingFields are the required struct fields which are absent from the result.
+	MissingFields []string
+	// Series are the keys of the mismatched series, set by DecodeGrouped.
+	Series []string
+}
+
+func (e *StrictDecodeError) Error() string {
+	var parts []string
+	if len(e.UnmappedColumns) > 0 {
+		parts = append(parts, "unmapped columns: "+strings.Join(e.UnmappedColumns, ", "))
+	}
+	if len(e.MissingFields) > 0 {
+		parts = append(parts, "missing required fields: "+strings.Join(e.MissingFields, ", "))
+	}
+	if len(e.Series) > 0 {
+		parts = append(parts, "in series: "+strings.Join(e.Series, " "))
+	}
+	return "strict decode: " + strings.Join(parts, "; ")
+}
+
+// merge merges the mismatches of the series with the key into e.
+func (e *StrictDecodeError) merge(key string, o *StrictDecodeError) {
+	e.UnmappedColumns = mergeSorted(e.UnmappedColumns, o.UnmappedColumns)
+	e.MissingFields = mergeSorted(e.MissingFields, o.MissingFields)
+	e.Series = append(e.Series, key)
+}
+
+func mergeSorted(a, b []string) []string {
+	for _, v := range b {
+		if i := sort.SearchStrings(a, v); i == len(a) || a[i] != v {
+			a = append(a, "")
+			copy(a[i+1:], a[i:])
+			a[i] = v
+		}
+	}
+	return a
+}
+
+func checkStrict(influxResult []models.Row, result interface{}, md *mapstruct.Metadata) error {
+	e := &StrictDecodeError{}
+
+	unused := make(map[string]bool)
+	for _, k := range md.Unused {
+		// keys of slice elements look like [0].columnName
+		if i := strings.LastIndex(k, "]."); i >= 0 {
+			k = k[i+2:]
+		}
+		if k != InfluxMeasurement && !unused[k] {
+			unused[k] = true
+			e.UnmappedColumns = append(e.UnmappedColumns, k)
+		}
+	}
+	sort.Strings(e.UnmappedColumns)
+
+	columns := resultColumns(influxResult)
+	for _, name := range requiredFields(result) {
+		if !columns.contains(name) {
+			e.MissingFields = append(e.MissingFields, name)
+		}
+	}
+
+	if len(e.UnmappedColumns) > 0 || len(e.MissingFields) > 0 {
+		return e
+	}
+
+	return nil
+}
+
+type columnSet map[string]bool
+
+// contains tells whether the column exists, matching case-insensitively like mapstruct does.
+func (s columnSet) contains(name string) bool {
+	if s[name] {
+		return true
+	}
+	for k := range s {
+		if strings.EqualFold(k, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func resultColumns(influxResult []models.Row) columnSet {
+	columns := make(columnSet)
+	for _, series := range influxResult {
+		for _, c := range series.Columns {
+			columns[c] = true
+		}
+		for tag := range series.Tags {
+			columns[tag] = true
+		}
+	}
+	return columns
+}
+
+// requiredFields returns the influx names of the struct fields tagged with required
+// in the element type of result.
+func requiredFields(result interface{}) []string {
+	t := reflect.TypeOf(result)
+	for t != nil && (t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	return structRequiredFields(t)
+}
+
+// structRequiredFields collects the required fields of the struct type t, including the ones
+// of the embedded and the influx:",squash" structs, which are decoded from the same row.
+func structRequiredFields(t reflect.Type) (names []string) {
+	for i := 0; i < t.NumField(); i++ {
+		ft := t.Field(i)
+		fd := ParseInfluxTag(ft.Name, ft.Tag.Get("influx"))
+		if fd.Name == "-" {
+			continue
+		}
+
+		if _, squash := fd.Properties["squash"]; squash || ft.Anonymous {
+			et := ft.Type
+			if et.Kind() == reflect.Ptr {
+				et = et.Elem()
+			}
+			if et.Kind() == reflect.Struct {
+				names = append(names, structRequiredFields(et)...)
+				continue
+			}
+		}
+
+		if _, ok := fd.Properties["required"]; ok {
+			names = append(names, fd.Name)
+		}
+	}
+
+	return names
+}
@@ -2,45 +2,161 @@ package influx
 
 import (
 	"fmt"
-	"regexp"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/influxdata/influxdb1-client/models"
 	client "github.com/influxdata/influxdb1-client/v2"
 )
 
-var measurementRe = regexp.MustCompile(`select\s+.+\s+from (\S+)`)
+func (c *Cli) queryTagKeys(cq *client.Query, series []models.Row, meta MeasurementMeta) (map[string]bool, error) {
+	keys := make(map[string]bool)
+	for _, key := range c.seriesCacheKeys(cq, series, meta) {
+		// 缓存 tag 键值列表，减少一次查询操作
+		m, err := c.getTagKeys(key, func(k CacheKey) (map[string]bool, error) {
+			return c.showTagKeys(*cq, k)
+		})
+		if err != nil {
+			return keys, err
+		}
+		for k := range m {
+			keys[k] = true
+		}
+	}
 
-func (c *Cli) queryTagKeys(cq *client.Query, series []models.Row) (map[string]bool, error) {
-	if len(series) == 0 {
+	return keys, nil
+}
+
+// queryTagValues queries all the values of the tag keys of the series' measurements from the server,
+// scoped by the time condition of the query.
+func (c *Cli) queryTagValues(cq *client.Query, series []models.Row, meta MeasurementMeta,
+	tagKeys map[string]bool,
+) (map[string][]string, error) {
+	keys := make([]string, 0, len(tagKeys))
+	for k := range tagKeys {
+		keys = append(keys, QuoteIdent(k))
+	}
+	if len(keys) == 0 {
 		return nil, nil
 	}
+	sort.Strings(keys)
+
+	condition := TimeCondition(cq.Command)
+	values := make(map[string]*set)
+	for _, key := range c.seriesCacheKeys(cq, series, meta) {
+		vk := tagValuesKey{CacheKey: key, Keys: strings.Join(keys, ","), Condition: condition}
+		loader := func(k tagValuesKey) (map[string][]string, error) { return c.showTagValues(*cq, k) }
+		var m map[string][]string
+		var err error
+		if c.tagValuesCache != nil {
+			m, err = c.tagValuesCache.Get(vk, loader)
+		} else {
+			m, err = loader(vk)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for k, vv := range m {
+			if _, ok := values[k]; !ok {
+				values[k] = newSet(0)
+			}
+			for _, v := range vv {
+				values[k].add(v)
+			}
+		}
+	}
 
-	measurement := series[0].Name
-	oldDb := cq.Database
+	result := make(map[string][]string, len(values))
+	for k, v := range values {
+		result[k] = v.toSlice()
+	}
+	return result, nil
+}
 
-	// 尝试从 select ... from 语句中提取完整表名（例如：metrics.autogen.QPS_dsvsServer）
-	// 然后尝试从中获取库名，因为执行 `show tag keys from "measurement"` 时必须有库名
-	if subs := measurementRe.FindStringSubmatch(cq.Command); len(subs) > 0 {
-		if strings.Contains(subs[1], ".") {
-			cq.Database = subs[1][:strings.Index(subs[1], ".")]
-			// defer reset old DB
-			defer func() { cq.Database = oldDb }()
+// seriesCacheKeys returns the distinct cache keys of the series' measurements.
+func (c *Cli) seriesCacheKeys(cq *client.Query, series []models.Row, meta MeasurementMeta) []CacheKey {
+	if len(series) == 0 {
+		return nil
+	}
+
+	// 解析语句的 FROM 子句中的完整表名（例如：metrics.autogen.QPS_dsvsServer），从中获取库名，
+	// 因为执行 `show tag keys from "measurement"` 时必须有库名。解析失败时，使用查询的默认库名
+	sources, err := ParseSources(cq.Command)
+	if err != nil {
+		c.log().Warn("influx parse sources failed, using the default db", "db", cq.Database, "error", err)
+	}
+
+	var keys []CacheKey
+	seen := make(map[CacheKey]bool)
+	for _, s := range series {
+		key := CacheKey{Addr: c.Addr, DB: tagKeysDB(s.Name, sources, meta, cq.Database), Measurement: s.Name}
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
 		}
 	}
+	return keys
+}
 
-	// 缓存 tag 键值列表，减少一次查询操作
-	key := cacheKey{Addr: c.Addr, DB: cq.Database, Measurement: measurement}
-	return cache.Get(key, func(k cacheKey) (map[string]bool, error) {
-		return c.showTagKeys(cq, k)
-	})
+// getTagKeys gets the tag keys from the cache, or loads them directly when the Cli has no cache,
+// e.g. not created by New.
+func (c *Cli) getTagKeys(k CacheKey, loader func(k CacheKey) (map[string]bool, error)) (map[string]bool, error) {
+	if c.tagKeysCache == nil {
+		return loader(k)
+	}
+	return c.tagKeysCache.Get(k, loader)
+}
+
+// InvalidateTagKeys removes the cached tag keys of the measurement, e.g. after its schema changed.
+func (c *Cli) InvalidateTagKeys(db, measurement string) {
+	if c.tagKeysCache != nil {
+		c.tagKeysCache.Invalidate(CacheKey{Addr: c.Addr, DB: db, Measurement: measurement})
+	}
 }
 
-func (c *Cli) showTagKeys(cq *client.Query, k cacheKey) (map[string]bool, error) {
+// invalidateNewTagKeys invalidates the cached tag keys when the written point introduces new tag keys.
+func (c *Cli) invalidateNewTagKeys(db string, p Point) {
+	if c.tagKeysCache == nil || len(p.Tags) == 0 {
+		return
+	}
+
+	k := CacheKey{Addr: c.Addr, DB: db, Measurement: p.Measurement}
+	keys, ok := c.tagKeysCache.GetIfPresent(k)
+	if !ok {
+		return
+	}
+	for tag := range p.Tags {
+		if !keys[tag] {
+			c.tagKeysCache.Invalidate(k)
+			return
+		}
+	}
+}
+
+// tagKeysDB returns the database of the measurement, declared on the struct, or qualified in the FROM clause.
+func tagKeysDB(measurement string, sources []Source, meta MeasurementMeta, defaultDB string) string {
+	if meta.DB != "" {
+		return meta.DB
+	}
+	for _, s := range sources {
+		if s.DB != "" && s.Match(measurement) {
+			return s.DB
+		}
+	}
+	return defaultDB
+}
+
+func (c *Cli) showTagKeys(cq client.Query, k CacheKey) (keys map[string]bool, err error) {
 	// 名称可能像 QPS_dsvsServer，需要双引号引用起来
-	cq.Command = `show tag keys from "` + k.Measurement + `"`
-	rsp, err := c.Query(*cq)
+	cq.Command = `show tag keys from ` + QuoteIdent(k.Measurement)
+	cq.Database = k.DB
+	start := time.Now()
+	defer func() {
+		c.observe(Event{Op: OpTagKeys, Query: cq.Command, DB: cq.Database, Points: len(keys), Err: err}, start)
+	}()
+
+	rsp, err := c.Query(cq)
 	if err != nil {
 		return nil, fmt.Errorf("execute %s %w", cq.Command, err)
 	}
@@ -49,7 +165,7 @@ func (c *Cli) showTagKeys(cq *client.Query, k cacheKey) (map[string]bool, error)
 	}
 
 	if r := rsp.Results; len(r) > 0 && len(r[0].Series) > 0 && len(r[0].Series[0].Values) > 0 {
-		keys := make(map[string]bool)
+		keys = make(map[string]bool)
 		for _, k := range r[0].Series[0].Values {
 			keys[k[0].(string)] = true
 		}
@@ -59,46 +175,124 @@ func (c *Cli) showTagKeys(cq *client.Query, k cacheKey) (map[string]bool, error)
 	return nil, nil
 }
 
+func (c *Cli) showTagValues(cq client.Query, k tagValuesKey) (values map[string][]string, err error) {
+	cq.Command = `show tag values from ` + QuoteIdent(k.Measurement) + ` with key in (` + k.Keys + `)`
+	if k.Condition != "" {
+		cq.Command += ` where ` + k.Condition
+	}
+	cq.Database = k.DB
+	start := time.Now()
+	rows := 0
+	defer func() {
+		c.observe(Event{Op: OpTagValues, Query: cq.Command, DB: cq.Database, Points: rows, Err: err}, start)
+	}()
+
+	rsp, err := c.Query(cq)
+	if err != nil {
+		return nil, fmt.Errorf("execute %s %w", cq.Command, err)
+	}
+	if err := rsp.Error(); err != nil {
+		return nil, fmt.Errorf("execute %s %w", cq.Command, err)
+	}
+
+	values = make(map[string][]string)
+	for _, r := range rsp.Results {
+		for _, s := range r.Series {
+			rows += len(s.Values)
+			// columns are key and value
+			for _, kv := range s.Values {
+				if len(kv) == 2 {
+					key, value := fmt.Sprintf("%v", kv[0]), fmt.Sprintf("%v", kv[1])
+					values[key] = append(values[key], value)
+				}
+			}
+		}
+	}
+	return values, nil
+}
+
 type tagsCollector interface {
-	collect(k string, v interface{})
-	complete(tags *map[string][]string)
+	collect(k string, v interface{}, rows int)
+	complete(option *QueryOption)
 }
 
 type noopTagsConnector struct{}
 
-func (t *noopTagsConnector) complete(tags *map[string][]string) {}
-func (t *noopTagsConnector) collect(k string, v interface{})    {}
+func (t *noopTagsConnector) complete(option *QueryOption)              {}
+func (t *noopTagsConnector) collect(k string, v interface{}, rows int) {}
 
 type tagsCollectorImpl struct {
 	tagKeys     map[string]bool
 	tagValues   map[string]*set
+	tagCounts   map[string]map[string]int
 	valuesLimit int
 }
 
-func (t *tagsCollectorImpl) complete(tags *map[string][]string) {
+func (t *tagsCollectorImpl) complete(option *QueryOption) {
+	if tags := option.ReturnTags; tags != nil && *tags == nil {
+		*tags = make(map[string][]string)
+	}
+	if histograms := option.ReturnTagHistograms; histograms != nil && *histograms == nil {
+		*histograms = make(map[string]TagHistogram)
+	}
+
 	for k := range t.tagKeys {
-		if tagValues, ok := t.tagValues[k]; ok {
-			(*tags)[k] = tagValues.toSlice()
-		} else {
-			(*tags)[k] = nil
+		if tags := option.ReturnTags; tags != nil {
+			if option.serverTagValues != nil {
+				(*tags)[k] = limitValues(option.serverTagValues[k], t.valuesLimit)
+			} else if tagValues, ok := t.tagValues[k]; ok {
+				(*tags)[k] = tagValues.toSlice()
+			} else {
+				(*tags)[k] = nil
+			}
+		}
+		if histograms := option.ReturnTagHistograms; histograms != nil {
+			(*histograms)[k] = newTagHistogram(t.tagCounts[k], option.ReturnTagValuesTopN)
+		}
+	}
+}
+
+// limitValues returns the first limit values, all if limit <= 0.
+func limitValues(values []string, limit int) []string {
+	if limit > 0 && len(values) > limit {
+		return values[:limit]
+	}
+	return values
+}
+
+// collectTags collects the tag values of the rows, including the tags of the series, into
+// option.ReturnTags and option.ReturnTagHistograms.
+func collectTags(influxResult []models.Row, option *QueryOption) {
+	tagCollector := makeTagsCollector(option)
+	for _, series := range influxResult {
+		for k, v := range series.Tags {
+			tagCollector.collect(k, v, len(series.Values))
+		}
+		for _, values := range series.Values {
+			for i, columnName := range series.Columns {
+				tagCollector.collect(columnName, values[i], 1)
+			}
 		}
 	}
+
+	tagCollector.complete(option)
 }
 
 func makeTagsCollector(option *QueryOption) tagsCollector {
-	if option.ReturnTags == nil || len(option.tagKeys) == 0 {
+	if !option.returnsTags() || len(option.tagKeys) == 0 {
 		return &noopTagsConnector{}
 	}
 
 	return &tagsCollectorImpl{
 		tagKeys:     option.tagKeys,
 		tagValues:   make(map[string]*set),
+		tagCounts:   make(map[string]map[string]int),
 		valuesLimit: option.ReturnTagValuesLimit,
 	}
 }
 
-func (t *tagsCollectorImpl) collect(k string, v interface{}) {
-	if !t.tagKeys[k] {
+func (t *tagsCollectorImpl) collect(k string, v interface{}, rows int) {
+	if !t.tagKeys[k] || v == nil || rows == 0 {
 		return
 	}
 
@@ -113,6 +307,48 @@ func (t *tagsCollectorImpl) collect(k string, v interface{}) {
 		t.tagValues[k] = m
 	}
 	m.add(cv)
+
+	c, ok := t.tagCounts[k]
+	if !ok {
+		c = make(map[string]int)
+		t.tagCounts[k] = c
+	}
+	c[cv] += rows
+}
+
+// TagValueCount is a tag value with the number of rows having it.
+type TagValueCount struct {
+	Value string
+	Count int
+}
+
+// TagHistogram is the histogram of the values of a tag.
+type TagHistogram struct {
+	// Values are the most frequent values, ordered by count descending, then by value.
+	Values []TagValueCount
+	// Truncated is the number of the distinct values which are not in Values because of the top N limit.
+	Truncated int
+}
+
+func newTagHistogram(counts map[string]int, topN int) TagHistogram {
+	h := TagHistogram{Values: make([]TagValueCount, 0, len(counts))}
+	for v, c := range counts {
+		h.Values = append(h.Values, TagValueCount{Value: v, Count: c})
+	}
+	sort.Slice(h.Values, func(i, j int) bool {
+		a, b := h.Values[i], h.Values[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Value < b.Value
+	})
+
+	if topN > 0 && len(h.Values) > topN {
+		h.Truncated = len(h.Values) - topN
+		h.Values = h.Values[:topN]
+	}
+
+	return h
 }
 
 type set struct {
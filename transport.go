@@ -0,0 +1,136 @@
+package influx
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+// WithTLSConfig set the TLS config of the HTTP transport, which overrides WithTLSFiles and WithInsecureSkipVerify.
+func WithTLSConfig(tlsConfig *tls.Config) ConfigFn {
+	return func(c *Config) { c.TLSConfig = tlsConfig }
+}
+
+// WithTLSFiles set the PEM files of the custom CA, and the client certificate and key for mutual TLS,
+// any of which can be empty. The files are loaded by New.
+func WithTLSFiles(caFile, certFile, keyFile string) ConfigFn {
+	return func(c *Config) {
+		c.CAFile = caFile
+		c.CertFile = certFile
+		c.KeyFile = keyFile
+	}
+}
+
+// WithInsecureSkipVerify skips the verification of the server certificate.
+func WithInsecureSkipVerify() ConfigFn { return func(c *Config) { c.InsecureSkipVerify = true } }
+
+// WithProxy set the proxy function, e.g. http.ProxyFromEnvironment or http.ProxyURL(u).
+func WithProxy(proxy func(*http.Request) (*url.URL, error)) ConfigFn {
+	return func(c *Config) { c.Proxy = proxy }
+}
+
+// WithUserAgent set the User-Agent header, which defaults to InfluxDBClient.
+func WithUserAgent(userAgent string) ConfigFn { return func(c *Config) { c.UserAgent = userAgent } }
+
+// WithHeader adds the header to every request, e.g. the token of an auth gateway.
+func WithHeader(key, value string) ConfigFn {
+	return func(c *Config) {
+		if c.Headers == nil {
+			c.Headers = make(http.Header)
+		}
+		c.Headers.Add(key, value)
+	}
+}
+
+// loadTLS builds the TLS config from the PEM files, if any.
+func (c *Config) loadTLS() error {
+	if c.TLSConfig != nil || c.CAFile == "" && c.CertFile == "" && c.KeyFile == "" {
+		return nil
+	}
+
+	tc := &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return fmt.Errorf("read CA file: %w", err)
+		}
+		tc.RootCAs = x509.NewCertPool()
+		if !tc.RootCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in CA file %s", c.CAFile)
+		}
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return fmt.Errorf("load client certificate: %w", err)
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+
+	c.TLSConfig = tc
+	return nil
+}
+
+// transport returns the HTTP transport by the TLS, proxy and header options.
+func (c *Config) transport() http.RoundTripper {
+	tr := &http.Transport{TLSClientConfig: c.TLSConfig, Proxy: c.Proxy}
+	if c.TLSConfig == nil && c.InsecureSkipVerify {
+		tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	if len(c.Headers) == 0 {
+		return tr
+	}
+	return &headerTransport{base: tr, headers: c.Headers}
+}
+
+// wrapTransport sets the extra headers on the requests of the client created by client.NewHTTPClient.
+// The influxdb client offers no option of the transport, so the one of its http.Client is wrapped.
+func (c *Config) wrapTransport(hc client.Client) error {
+	if len(c.Headers) == 0 {
+		return nil
+	}
+
+	v := reflect.ValueOf(hc)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	var f reflect.Value
+	if v.Kind() == reflect.Struct {
+		f = v.FieldByName("httpClient")
+	}
+	if !f.IsValid() || f.Type() != reflect.TypeOf(&http.Client{}) || f.IsNil() {
+		return fmt.Errorf("unable to set the headers on the transport of %T", hc)
+	}
+
+	h := (*http.Client)(f.UnsafePointer())
+	h.Transport = &headerTransport{base: h.Transport, headers: c.Headers}
+	return nil
+}
+
+// headerTransport sets the extra headers on the requests, and delegates to the base transport.
+type headerTransport struct {
+	base    http.RoundTripper
+	headers http.Header
+}
+
+func (t *headerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	// a RoundTripper must not modify the request
+	r = r.Clone(r.Context())
+	for k, v := range t.headers {
+		r.Header[k] = v
+	}
+	return t.base.RoundTrip(r)
+}
+
+// CloseIdleConnections closes the idle connections of the base transport, called by http.Client.
+func (t *headerTransport) CloseIdleConnections() {
+	if c, ok := t.base.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,109 @@
+package influx_test
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/influx"
+)
+
+func TestTLSAndHeaders(t *testing.T) {
+	var userAgent, token string
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent, token = r.UserAgent(), r.Header.Get("X-Gateway-Token")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"results":[{"series":[{"name":"cpu","columns":["time","v"],"values":[["2021-12-09T04:31:20Z",1]]}]}]}`))
+	}))
+	defer ts.Close()
+
+	var v []float64
+	c, err := influx.New(influx.WithAddr(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DecodeQuery(`SELECT v FROM cpu`, &v); err == nil {
+		t.Error("expected the certificate verification failure")
+	}
+
+	c, err = influx.New(influx.WithAddr(ts.URL), influx.WithInsecureSkipVerify(),
+		influx.WithUserAgent("my-agent"), influx.WithHeader("X-Gateway-Token", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DecodeQuery(`SELECT v FROM cpu`, &v); err != nil {
+		t.Fatal(err)
+	}
+	if userAgent != "my-agent" || token != "secret" {
+		t.Errorf("unexpected headers, User-Agent: %q, X-Gateway-Token: %q", userAgent, token)
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	if err := os.WriteFile(caFile, ca, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c, err = influx.New(influx.WithAddr(ts.URL), influx.WithTLSFiles(caFile, "", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DecodeQuery(`SELECT v FROM cpu`, &v); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := influx.New(influx.WithTLSFiles(filepath.Join(t.TempDir(), "missing.pem"), "", "")); err == nil {
+		t.Error("expected the error of the missing CA file")
+	}
+}
+
+func TestHeadersWithProxy(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.URL.Path+"|"+r.Header.Get("X-Gateway-Token"))
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/ping", "/write":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"results":[{}]}`))
+		}
+	}))
+	defer ts.Close()
+
+	var proxied int
+	proxy := func(r *http.Request) (*url.URL, error) {
+		proxied++
+		return nil, nil
+	}
+	c, err := influx.New(influx.WithAddr(ts.URL), influx.WithProxy(proxy), influx.WithHeader("X-Gateway-Token", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := c.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WritePointRaw(influx.Point{Measurement: "cpu", Fields: map[string]interface{}{"v": 1}, Time: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	var v []float64
+	if err := c.DecodeQuery(`SELECT v FROM cpu`, &v); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"/ping|secret", "/write|secret", "/query|secret"}
+	if !reflect.DeepEqual(requests, expected) || proxied == 0 {
+		t.Errorf("expected the headers on all requests through the proxy, got %v, proxied %d", requests, proxied)
+	}
+}
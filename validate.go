@@ -0,0 +1,241 @@
+package influx
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ValidationPolicy tells how the invalid tags and fields of a point are handled before writing.
+type ValidationPolicy int
+
+const (
+	// ValidateNone skips the validation, the server decides.
+	ValidateNone ValidationPolicy = iota
+	// ValidateReject fails the write with a *ValidationError.
+	ValidateReject
+	// ValidateDrop drops the invalid tags and fields, and writes the rest.
+	ValidateDrop
+	// ValidateCoerce converts the invalid values into valid ones where possible, and drops the others.
+	// A field whose key collides with a tag key is renamed to key_field, like InfluxDB does on the queries.
+	ValidateCoerce
+)
+
+// ValidateOption defines the options for validating points.
+type ValidateOption struct {
+	Policy ValidationPolicy
+	// AllowUnsigned tells the server supports unsigned integer fields (uint64 written with the u suffix),
+	// which the servers before 1.6 (or without the feature enabled) do not.
+	AllowUnsigned bool
+}
+
+// WithValidation set the validation of the points before writing.
+func WithValidation(option ValidateOption) ConfigFn { return func(c *Config) { c.Validate = option } }
+
+// Violation is an invalid tag or field of a point.
+type Violation struct {
+	// Key is the tag key or field key.
+	Key string
+	// StructField is the name of the struct field which the tag or field is encoded from, if any.
+	StructField string
+	IsTag       bool
+	Reason      string
+}
+
+func (v Violation) String() string {
+	if v.Key == "" && v.StructField == "" {
+		return v.Reason
+	}
+
+	kind := "field"
+	if v.IsTag {
+		kind = "tag"
+	}
+	if v.StructField != "" {
+		return fmt.Sprintf("%s %s (%s): %s", kind, v.Key, v.StructField, v.Reason)
+	}
+	return fmt.Sprintf("%s %s: %s", kind, v.Key, v.Reason)
+}
+
+// ValidationError lists all the invalid tags and fields of a point.
+type ValidationError struct {
+	Measurement string
+	Violations  []Violation
+}
+
+func (e *ValidationError) Error() string {
+	s := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		s[i] = v.String()
+	}
+	return fmt.Sprintf("invalid point %s: %s", e.Measurement, strings.Join(s, "; "))
+}
+
+// Validate checks the tags and fields of the point by the option.
+// It returns the point with the invalid tags and fields dropped or coerced according to the policy,
+// or a *ValidationError when the policy is ValidateReject or the point cannot be written at all.
+func (p Point) Validate(option ValidateOption) (Point, error) {
+	if option.Policy == ValidateNone {
+		return p, nil
+	}
+
+	e := &ValidationError{Measurement: p.Measurement}
+	violate := func(key string, isTag bool, reason string) {
+		e.Violations = append(e.Violations, Violation{
+			Key: key, StructField: p.structFields[key], IsTag: isTag, Reason: reason,
+		})
+	}
+
+	// the copy keeps all but the validated tags and fields, like the db and rp to write to
+	v := p
+	v.Tags = make(map[string]string, len(p.Tags))
+	v.Fields = make(map[string]interface{}, len(p.Fields))
+
+	// the sorted keys keep the order of the violations stable
+	for _, key := range sortedKeys(p.Tags) {
+		value := p.Tags[key]
+		switch {
+		case key == "":
+			violate(key, true, "empty tag key")
+		case value == "":
+			violate(key, true, "empty tag value")
+		default:
+			v.Tags[key] = value
+		}
+	}
+
+	for _, key := range sortedKeys(p.Fields) {
+		value := p.Fields[key]
+		if key == "" {
+			violate(key, false, "empty field key")
+			continue
+		}
+
+		if _, ok := v.Tags[key]; ok {
+			violate(key, false, "field key collides with tag key")
+			if option.Policy == ValidateCoerce {
+				if fv, ok := coerceField(value, option); ok {
+					v.Fields[key+"_field"] = fv
+				}
+			}
+			continue
+		}
+
+		if reason := checkField(value, option); reason != "" {
+			violate(key, false, reason)
+			if option.Policy == ValidateCoerce {
+				if fv, ok := coerceField(value, option); ok {
+					v.Fields[key] = fv
+				}
+			}
+			continue
+		}
+
+		v.Fields[key] = value
+	}
+
+	if p.Measurement == "" {
+		violate("", false, "empty measurement")
+		return p, e
+	}
+
+	if len(e.Violations) > 0 && option.Policy == ValidateReject {
+		return p, e
+	}
+
+	if len(v.Fields) == 0 {
+		violate("", false, "no valid fields left")
+		return p, e
+	}
+
+	return v, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// checkField returns the reason why the field value is invalid, or empty if valid.
+func checkField(value interface{}, option ValidateOption) string {
+	switch fv := value.(type) {
+	case nil:
+		return "nil value"
+	case float64:
+		return checkFloat(fv)
+	case float32:
+		return checkFloat(float64(fv))
+	case uint64:
+		if !option.AllowUnsigned {
+			return "unsigned integer unsupported"
+		}
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, string, bool:
+	default:
+		return fmt.Sprintf("unsupported type %T", value)
+	}
+
+	return ""
+}
+
+func checkFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN is unsupported"
+	case math.IsInf(f, 0):
+		return "+/-Inf is unsupported"
+	}
+	return ""
+}
+
+// coerceField tries to convert the field value into a valid one.
+func coerceField(value interface{}, option ValidateOption) (interface{}, bool) {
+	if checkField(value, option) == "" {
+		return value, true
+	}
+
+	switch fv := value.(type) {
+	case nil:
+		return nil, false
+	case uint64:
+		if fv <= math.MaxInt64 {
+			return int64(fv), true
+		}
+		return nil, false
+	case time.Time:
+		return fv.UnixNano(), true
+	case time.Duration:
+		return int64(fv), true
+	case []byte:
+		return string(fv), true
+	case fmt.Stringer:
+		return fv.String(), true
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return nil, false
+		}
+		return coerceField(rv.Elem().Interface(), option)
+	case reflect.Bool:
+		return rv.Bool(), true
+	case reflect.String:
+		return rv.String(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true
+	case reflect.Float32, reflect.Float64:
+		if checkFloat(rv.Float()) == "" {
+			return rv.Float(), true
+		}
+	}
+
+	return nil, false
+}
@@ -0,0 +1,88 @@
+package influx
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+// WithToken set the API token of InfluxDB 2.x, which authenticates the v1 compatible endpoints unless WithUser,
+// and makes the writes go to the /api/v2/write endpoint when the server is detected as 2.x, with the bucket db/rp
+// and the org of WithOrg.
+func WithToken(token string) ConfigFn { return func(c *Config) { c.Token = token } }
+
+// WithOrg set the organization name of InfluxDB 2.x, which the /api/v2/write endpoint requires with the bucket.
+func WithOrg(org string) ConfigFn { return func(c *Config) { c.Org = org } }
+
+// v2Client writes to /api/v2/write when the server is InfluxDB 2.x, detected by ping on the first write.
+type v2Client struct {
+	client.Client
+	addr string
+	org  string
+	http *httpDoer
+
+	mu       sync.Mutex
+	detected bool
+	v2       bool
+}
+
+// v2Precisions maps the v1 precisions to the v2 ones, h and m are unsupported by v2.
+var v2Precisions = map[string]string{"": "ns", "ns": "ns", "u": "us", "us": "us", "ms": "ms", "s": "s"}
+
+func (c *v2Client) Write(bp client.BatchPoints) error {
+	precision, ok := v2Precisions[bp.Precision()]
+	if !ok || !c.isV2() {
+		return c.Client.Write(bp)
+	}
+
+	var b bytes.Buffer
+	for _, p := range bp.Points() {
+		b.WriteString(p.PrecisionString(bp.Precision()))
+		b.WriteByte('\n')
+	}
+
+	bucket := bp.Database()
+	if rp := bp.RetentionPolicy(); rp != "" {
+		bucket += "/" + rp
+	}
+	params := url.Values{"org": {c.org}, "bucket": {bucket}, "precision": {precision}}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(c.addr, "/")+"/api/v2/write?"+params.Encode(), &b)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+
+	rsp, err := c.http.do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	body, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return err
+	}
+	if rsp.StatusCode != http.StatusNoContent && rsp.StatusCode != http.StatusOK {
+		return errors.New(string(body))
+	}
+	return nil
+}
+
+// isV2 detects the server version once, which is retried on the next write if the ping failed.
+func (c *v2Client) isV2() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.detected {
+		if _, version, err := c.Client.Ping(0); err == nil {
+			c.detected, c.v2 = true, ParseServerVersion(version).IsV2()
+		}
+	}
+	return c.v2
+}